@@ -41,7 +41,7 @@ cp -r $project_dir/server-fe/dist $project_dir/server-be/web/
 cd $project_dir/server-be
 export GOOS=linux
 go mod tidy
-go build -a -o multimodal_search multimodal_search.go
+go build -a -o multimodal_search .
 
 echo "build docker image..."
 cd $project_dir/dockerfile
@@ -5,11 +5,10 @@ from sentence_transformers import SentenceTransformer
 import numpy as np
 model_text = SentenceTransformer("/root/models/nomic-ai/nomic-embed-text-v1.5", trust_remote_code=True)
 
-# 返回字符串 "[0.1 0.2 0.3]"
+# 返回浮点数组 [0.1, 0.2, 0.3]
 def get_text_embedding_vector(sentences):
     embeddings = model_text.encode(sentences)
-    embeddings_str = np.array2string(embeddings,formatter={'float_kind':lambda x: f'{x:.10f}'}).replace('\n', '')
-    return embeddings_str
+    return embeddings.tolist()
 
 print("loading model omic-embed-vision-v1.5...")
 import torch
@@ -20,17 +19,21 @@ import requests
 processor = AutoImageProcessor.from_pretrained("/root/models/nomic-ai/nomic-embed-vision-v1.5")
 vision_model = AutoModel.from_pretrained("/root/models/nomic-ai/nomic-embed-vision-v1.5", trust_remote_code=True)
 
-def get_image_embedding_vector(imageUrl):
+def load_image(imageUrl):
     if imageUrl.startswith("http"):
-        image = Image.open(requests.get(imageUrl, stream=True).raw)
-    else:
-        image = Image.open(imageUrl)
-    inputs = processor(image, return_tensors="pt")
+        return Image.open(requests.get(imageUrl, stream=True).raw)
+    return Image.open(imageUrl)
+
+# 一次前向计算多张图片, 返回浮点数组的列表
+def get_image_embedding_vectors(imageUrls):
+    images = [load_image(url) for url in imageUrls]
+    inputs = processor(images, return_tensors="pt")
     img_emb = vision_model(**inputs).last_hidden_state
     img_embeddings = F.normalize(img_emb[:, 0], p=2, dim=1)
-    img_embeddings_np = img_embeddings.detach().numpy()[0]
-    embeddings_str = np.array2string(img_embeddings_np,formatter={'float_kind':lambda x: f'{x:.10f}'}).replace('\n', '')
-    return embeddings_str
+    return img_embeddings.detach().numpy().tolist()
+
+def get_image_embedding_vector(imageUrl):
+    return get_image_embedding_vectors([imageUrl])[0]
 
 # pip install fastapi uvicorn
 from fastapi import FastAPI
@@ -44,8 +47,8 @@ app = FastAPI()
 async def embed_txt_query(request: Request):
     try:
         json_params = await request.json()
-        vecstr = get_text_embedding_vector(json_params["data"])
-        return JSONResponse(content={"embedding": vecstr})
+        vec = get_text_embedding_vector(json_params["data"])
+        return JSONResponse(content={"embedding": vec})
     except KeyError as e:
         return JSONResponse(content={"error": f"Missing key in JSON parameters: {e}"}, status_code=400)
     except Exception as e:
@@ -55,8 +58,19 @@ async def embed_txt_query(request: Request):
 async def embed_img_query(request: Request):
     try:
         json_params = await request.json()
-        vecstr = get_image_embedding_vector(json_params["url"])
-        return JSONResponse(content={"embedding": vecstr})
+        vec = get_image_embedding_vector(json_params["url"])
+        return JSONResponse(content={"embedding": vec})
+    except KeyError as e:
+        return JSONResponse(content={"error": f"Missing key in JSON parameters: {e}"}, status_code=400)
+    except Exception as e:
+        return JSONResponse(content={"error": f"An unexpected error occurred: {e}"}, status_code=500)
+
+@app.post("/get_img_vecs")
+async def embed_img_batch_query(request: Request):
+    try:
+        json_params = await request.json()
+        vecs = get_image_embedding_vectors(json_params["urls"])
+        return JSONResponse(content={"embeddings": vecs})
     except KeyError as e:
         return JSONResponse(content={"error": f"Missing key in JSON parameters: {e}"}, status_code=400)
     except Exception as e:
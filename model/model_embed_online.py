@@ -9,7 +9,7 @@ def get_text_embedding_vector(sentences, api_key):
     dashscope.api_key = api_key
     input = [{'text': sentences}]
     resp = dashscope.MultiModalEmbedding.call(model="multimodal-embedding-v1",input=input)
-    return str(resp.output.get('embeddings')[0].get('embedding')).replace(', ', ' ')
+    return resp.output.get('embeddings')[0].get('embedding')
 
 import dashscope
 import base64
@@ -21,7 +21,7 @@ def get_image_embedding_vector(imageUrl, api_key):
         image = imageUrl
         input = [{'image': image}]
         resp = dashscope.MultiModalEmbedding.call(model="multimodal-embedding-v1",input=input)
-        return str(resp.output.get('embeddings')[0].get('embedding')).replace(', ', ' ')
+        return resp.output.get('embeddings')[0].get('embedding')
     else:
         image_path = imageUrl
         image_format = os.path.splitext(image_path)[1].strip('.')
@@ -30,7 +30,7 @@ def get_image_embedding_vector(imageUrl, api_key):
         image_data = f"data:image/{image_format};base64,{base64_image}"
         inputs = [{'image': image_data}]
         resp = dashscope.MultiModalEmbedding.call(model="multimodal-embedding-v1",input=inputs)
-        return str(resp.output.get('embeddings')[0].get('embedding')).replace(', ', ' ')
+        return resp.output.get('embeddings')[0].get('embedding')
 
 # pip install fastapi uvicorn
 from fastapi import FastAPI
@@ -44,8 +44,8 @@ app = FastAPI()
 async def embed_txt_query(request: Request):
     try:
         json_params = await request.json()
-        vecstr = get_text_embedding_vector(json_params["data"], json_params["api_key"])
-        return JSONResponse(content={"embedding": vecstr})
+        vec = get_text_embedding_vector(json_params["data"], json_params["api_key"])
+        return JSONResponse(content={"embedding": vec})
     except KeyError as e:
         return JSONResponse(content={"error": f"Missing key in JSON parameters: {e}"}, status_code=400)
     except Exception as e:
@@ -55,8 +55,19 @@ async def embed_txt_query(request: Request):
 async def embed_img_query(request: Request):
     try:
         json_params = await request.json()
-        vecstr = get_image_embedding_vector(json_params["url"], json_params["api_key"])
-        return JSONResponse(content={"embedding": vecstr})
+        vec = get_image_embedding_vector(json_params["url"], json_params["api_key"])
+        return JSONResponse(content={"embedding": vec})
+    except KeyError as e:
+        return JSONResponse(content={"error": f"Missing key in JSON parameters: {e}"}, status_code=400)
+    except Exception as e:
+        return JSONResponse(content={"error": f"An unexpected error occurred: {e}"}, status_code=500)
+
+@app.post("/get_img_vecs")
+async def embed_img_batch_query(request: Request):
+    try:
+        json_params = await request.json()
+        vecs = [get_image_embedding_vector(url, json_params["api_key"]) for url in json_params["urls"]]
+        return JSONResponse(content={"embeddings": vecs})
     except KeyError as e:
         return JSONResponse(content={"error": f"Missing key in JSON parameters: {e}"}, status_code=400)
     except Exception as e:
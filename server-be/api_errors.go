@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Error codes of the API. Every failed request is answered with an apiError
+// carrying one of them; docs/readme.md lists them for clients.
+const (
+	codeInvalidJSON        = "INVALID_JSON"
+	codeInvalidParams      = "INVALID_PARAMS"
+	codeInstanceNotFound   = "INSTANCE_NOT_FOUND"
+	codeInstanceExists     = "INSTANCE_EXISTS"
+	codeJobNotFound        = "JOB_NOT_FOUND"
+	codeImportRunning      = "IMPORT_RUNNING"
+	codeCollectionNotFound = "COLLECTION_NOT_FOUND"
+	codeCollectionExists   = "COLLECTION_EXISTS"
+	codePartitionNotFound  = "PARTITION_NOT_FOUND"
+	codePartitionExists    = "PARTITION_EXISTS"
+	codeImageNotFound      = "IMAGE_NOT_FOUND"
+	codeDimMismatch        = "DIM_MISMATCH"
+	codeUnsupportedIndex   = "UNSUPPORTED_INDEX"
+	codeInvalidFilter      = "INVALID_FILTER"
+	codeMilvusUnavailable  = "MILVUS_UNAVAILABLE"
+	codeEmbedderFailed     = "EMBEDDER_FAILED"
+	codeStoreFailed        = "STORE_FAILED"
+	codeUploadFailed       = "UPLOAD_FAILED"
+	codeInternal           = "INTERNAL_ERROR"
+)
+
+var errorStatus = map[string]int{
+	codeInvalidJSON:        http.StatusBadRequest,
+	codeInvalidParams:      http.StatusBadRequest,
+	codeInstanceNotFound:   http.StatusNotFound,
+	codeInstanceExists:     http.StatusConflict,
+	codeJobNotFound:        http.StatusNotFound,
+	codeImportRunning:      http.StatusConflict,
+	codeCollectionNotFound: http.StatusNotFound,
+	codeCollectionExists:   http.StatusConflict,
+	codePartitionNotFound:  http.StatusNotFound,
+	codePartitionExists:    http.StatusConflict,
+	codeImageNotFound:      http.StatusNotFound,
+	codeDimMismatch:        http.StatusBadRequest,
+	codeUnsupportedIndex:   http.StatusBadRequest,
+	codeInvalidFilter:      http.StatusBadRequest,
+	codeMilvusUnavailable:  http.StatusServiceUnavailable,
+	codeEmbedderFailed:     http.StatusBadGateway,
+	codeStoreFailed:        http.StatusInternalServerError,
+	codeUploadFailed:       http.StatusInternalServerError,
+	codeInternal:           http.StatusInternalServerError,
+}
+
+// Errors that the stores and the embedders wrap so that handlers can pick
+// the error code.
+var (
+	errCollectionNotFound = errors.New("collection not found")
+	errCollectionExists   = errors.New("collection already exists")
+	errDimMismatch        = errors.New("dim mismatch")
+	errPartitionNotFound  = errors.New("partition not found")
+	errPartitionExists    = errors.New("partition already exists")
+	// errInvalidPartition rejects partition operations the collection does
+	// not allow, such as dropping the default partition.
+	errInvalidPartition = errors.New("invalid partition operation")
+)
+
+// apiError is the body of every error response.
+type apiError struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id"`
+}
+
+const requestIDKey = "request_id"
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// requestID tags each request with the X-Request-ID sent by the client, or a
+// new one, and echoes it in the response.
+func requestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader("X-Request-ID")
+		if !requestIDPattern.MatchString(id) {
+			id = newJobID()
+		}
+		c.Set(requestIDKey, id)
+		c.Header("X-Request-ID", id)
+		c.Next()
+	}
+}
+
+// logFormatter is the access log format of gin.Logger, with the credentials
+// of a query string masked.
+func logFormatter(param gin.LogFormatterParams) string {
+	if param.Latency > time.Minute {
+		param.Latency = param.Latency.Truncate(time.Second)
+	}
+	return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		param.StatusCode,
+		param.Latency,
+		param.ClientIP,
+		param.Method,
+		redactQuery(param.Path),
+		param.ErrorMessage,
+	)
+}
+
+// redactQuery masks the values of instanceSecrets in the query string of
+// path. A query that does not parse is dropped.
+func redactQuery(path string) string {
+	base, rawQuery, found := strings.Cut(path, "?")
+	if !found {
+		return path
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return base
+	}
+	for key := range instanceSecrets {
+		if query.Has(key) {
+			query.Set(key, "redacted")
+		}
+	}
+	return base + "?" + query.Encode()
+}
+
+// respondError aborts the request with an apiError.
+func respondError(c *gin.Context, code string, message string, details interface{}) {
+	status, ok := errorStatus[code]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	c.AbortWithStatusJSON(status, apiError{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: c.GetString(requestIDKey),
+	})
+}
+
+// respondStoreError answers a failed VectorStore call made while doing what,
+// e.g. "failed to search".
+func respondStoreError(c *gin.Context, what string, err error) {
+	log.Printf("[%s] %s, err: %s", c.GetString(requestIDKey), what, err.Error())
+	code := codeStoreFailed
+	switch {
+	case errors.Is(err, errCollectionNotFound):
+		code = codeCollectionNotFound
+	case errors.Is(err, errCollectionExists):
+		code = codeCollectionExists
+	case errors.Is(err, errPartitionNotFound):
+		code = codePartitionNotFound
+	case errors.Is(err, errPartitionExists):
+		code = codePartitionExists
+	case errors.Is(err, errInvalidPartition):
+		code = codeInvalidParams
+	case errors.Is(err, errDimMismatch):
+		code = codeDimMismatch
+	case errors.Is(err, errUnknownIndexType):
+		code = codeUnsupportedIndex
+	case errors.Is(err, errInvalidFilter):
+		code = codeInvalidFilter
+	}
+	respondError(c, code, fmt.Sprintf("%s: %s", what, err.Error()), nil)
+}
+
+// recoverPanic answers a panicking handler with INTERNAL_ERROR instead of an
+// empty 500.
+func recoverPanic(c *gin.Context, recovered interface{}) {
+	log.Printf("[%s] panic: %v", c.GetString(requestIDKey), recovered)
+	respondError(c, codeInternal, "internal server error", nil)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CollectionResponse is one collection of a GET /api/collections response.
+type CollectionResponse struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Dim         int64                  `json:"dim"`
+	RowCount    int64                  `json:"row_count"`
+	IndexType   string                 `json:"index_type"`
+	MetricType  string                 `json:"metric_type"`
+	IndexParams map[string]interface{} `json:"index_params"`
+	LoadState   string                 `json:"load_state"`
+	Fields      []CollectionField      `json:"fields"`
+	UploadDir   string                 `json:"upload_dir"`
+	UploadFiles int                    `json:"upload_files"`
+	UploadBytes int64                  `json:"upload_bytes"`
+	// Error is set instead of the details when the collection could not be
+	// described.
+	Error string `json:"error,omitempty"`
+}
+
+// CollectionField is a field of the collection schema: the primary key, the
+// vector, the image url and hash, and the metadata fields.
+type CollectionField struct {
+	MetaField
+	Dim        int64 `json:"dim,omitempty"`
+	PrimaryKey bool  `json:"primary_key,omitempty"`
+}
+
+// collectionFields returns the schema of a collection described by info.
+func collectionFields(info CollectionInfo) []CollectionField {
+	fields := []CollectionField{
+		{MetaField: MetaField{Name: "id", Type: metaTypeInt}, PrimaryKey: true},
+		{MetaField: MetaField{Name: milvusVecField, Type: "float_vector"}, Dim: info.Dim},
+		{MetaField: MetaField{Name: milvusUrlField, Type: metaTypeString, MaxLength: 500}},
+	}
+	if info.HasHash {
+		fields = append(fields, CollectionField{MetaField: MetaField{Name: milvusHashField, Type: metaTypeString, MaxLength: 64}})
+	}
+	for _, field := range info.MetaFields {
+		fields = append(fields, CollectionField{MetaField: field})
+	}
+	return fields
+}
+
+// uploadDirUsage returns the number of images in dir and the bytes taken by
+// everything in it, upload metadata included. A missing dir is empty.
+func uploadDirUsage(dir string) (int, int64) {
+	files := 0
+	var size int64
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			size += info.Size()
+		}
+		// Files under dot folders are metadata, not images.
+		rel, _ := filepath.Rel(dir, path)
+		if !strings.HasPrefix(rel, ".") && !strings.Contains(rel, string(filepath.Separator)+".") {
+			files++
+		}
+		return nil
+	})
+	return files, size
+}
+
+func collectionList(gincontext *gin.Context) {
+	var req CollectionListRequest
+	if !bindRouteParams(gincontext, &req, nil) {
+		return
+	}
+	ctx := context.Background()
+	store, err := newVectorStore(ctx, req.storeConfig())
+	if err != nil {
+		log.Println("failed to connect to milvus, err: ", err.Error())
+		respondError(gincontext, codeMilvusUnavailable, "failed to connect to milvus: "+err.Error(), nil)
+		return
+	}
+	defer store.Close()
+
+	names, err := store.ListCollections(ctx)
+	if err != nil {
+		respondStoreError(gincontext, "failed to list collections", err)
+		return
+	}
+	data := make([]CollectionResponse, 0, len(names))
+	for _, name := range names {
+		resp := CollectionResponse{Name: name, UploadDir: uploadServerPath + "/" + name}
+		resp.UploadFiles, resp.UploadBytes = uploadDirUsage(resp.UploadDir)
+		info, err := store.Describe(ctx, name)
+		if err != nil {
+			log.Println("failed to describe collection "+name+", err: ", err.Error())
+			resp.Error = err.Error()
+			data = append(data, resp)
+			continue
+		}
+		resp.Description = info.Description
+		resp.Dim = info.Dim
+		resp.RowCount = info.RowCount
+		resp.IndexType = info.IndexType
+		resp.MetricType = info.MetricType
+		resp.IndexParams = info.IndexParams
+		resp.LoadState = info.LoadState
+		resp.Fields = collectionFields(info)
+		data = append(data, resp)
+	}
+	gincontext.JSON(http.StatusOK, gin.H{"message": "success", "data": data})
+}
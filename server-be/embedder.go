@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Embedder turns images and texts into vectors of the same embedding space.
+type Embedder interface {
+	EmbedImage(ctx context.Context, path string) ([]float32, error)
+	// EmbedImages embeds several images in as few requests as the provider
+	// allows and returns one vector per path, in order.
+	EmbedImages(ctx context.Context, paths []string) ([][]float32, error)
+	EmbedText(ctx context.Context, text string) ([]float32, error)
+}
+
+const (
+	embedProviderLegacy   = "legacy"
+	embedProviderOpenAI   = "openai"
+	embedProviderTemplate = "template"
+)
+
+// EmbedderConfig selects and configures the embedding provider of an instance.
+type EmbedderConfig struct {
+	// Provider is one of legacy (default), openai or template.
+	Provider string
+	Url      string
+	ApiKey   string
+	// Model is sent as the model name by the openai and template providers.
+	Model string
+	// TextTemplate and ImageTemplate are the JSON request bodies of the
+	// template provider, see templateEmbedder.
+	TextTemplate  string
+	ImageTemplate string
+	// ResponsePath locates the vector in the template provider's response,
+	// e.g. "data.0.embedding".
+	ResponsePath string
+}
+
+// embedHTTPClient is shared by all embedders.
+var embedHTTPClient = &http.Client{Timeout: 2 * time.Minute}
+
+// defaultEmbedBatchSize is the number of images per embedding request during
+// import, unless the request sets embed_batch_size.
+var defaultEmbedBatchSize = 16
+
+// embedStatusError is returned by postJSON when the embedding service answers
+// with a non 2xx status.
+type embedStatusError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *embedStatusError) Error() string {
+	return fmt.Sprintf("embed server returned %s: %s", e.Status, e.Body)
+}
+
+func newEmbedder(cfg EmbedderConfig) (Embedder, error) {
+	if cfg.Url == "" {
+		return nil, fmt.Errorf("embed server url is required")
+	}
+	switch cfg.Provider {
+	case "", embedProviderLegacy:
+		return &legacyEmbedder{url: strings.TrimRight(cfg.Url, "/"), apikey: cfg.ApiKey}, nil
+	case embedProviderOpenAI:
+		return newOpenAIEmbedder(cfg), nil
+	case embedProviderTemplate:
+		return newTemplateEmbedder(cfg)
+	}
+	return nil, fmt.Errorf("unknown embed provider: %q", cfg.Provider)
+}
+
+// postJSON posts payload to url and decodes the JSON response into out. A non
+// 2xx status is reported as an error carrying the start of the response body.
+func postJSON(ctx context.Context, url string, headers map[string]string, payload []byte, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := embedHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet := string(body)
+		if len(snippet) > 200 {
+			snippet = snippet[:200]
+		}
+		return &embedStatusError{StatusCode: resp.StatusCode, Status: resp.Status, Body: snippet}
+	}
+	return json.Unmarshal(body, out)
+}
+
+// embedImagesOneByOne implements EmbedImages for providers without a batch
+// API.
+func embedImagesOneByOne(ctx context.Context, e Embedder, paths []string) ([][]float32, error) {
+	vecs := make([][]float32, 0, len(paths))
+	for _, path := range paths {
+		vec, err := e.EmbedImage(ctx, path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		vecs = append(vecs, vec)
+	}
+	return vecs, nil
+}
+
+// parseEmbeddingValue converts a decoded JSON embedding into a vector. It
+// accepts an array of numbers, a base64 string of little-endian float32
+// values, or the legacy "[0.1 0.2]" string.
+func parseEmbeddingValue(v interface{}) ([]float32, error) {
+	var vec []float32
+	switch value := v.(type) {
+	case string:
+		if decoded, ok := decodeBase64Embedding(value); ok {
+			vec = decoded
+			break
+		}
+		parsed, err := stringToFloat32Slice(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid embedding string: %w", err)
+		}
+		vec = parsed
+	case []interface{}:
+		vec = make([]float32, 0, len(value))
+		for i, item := range value {
+			f, ok := item.(float64)
+			if !ok {
+				return nil, fmt.Errorf("embedding element %d is not a number", i)
+			}
+			vec = append(vec, float32(f))
+		}
+	case nil:
+		return nil, fmt.Errorf("embedding is missing")
+	default:
+		return nil, fmt.Errorf("unsupported embedding type %T", v)
+	}
+	if len(vec) == 0 {
+		return nil, fmt.Errorf("embedding is empty")
+	}
+	for i, f := range vec {
+		if math.IsNaN(float64(f)) || math.IsInf(float64(f), 0) {
+			return nil, fmt.Errorf("embedding element %d is not finite", i)
+		}
+	}
+	return vec, nil
+}
+
+// decodeBase64Embedding decodes a base64 payload of little-endian float32
+// values. Decimal strings never qualify: '.', '-' and whitespace are not in
+// the standard base64 alphabet and digit-only strings rarely decode to a
+// multiple of four bytes.
+func decodeBase64Embedding(s string) ([]float32, bool) {
+	if len(s) == 0 || len(s)%4 != 0 {
+		return nil, false
+	}
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(data) == 0 || len(data)%4 != 0 {
+		return nil, false
+	}
+	vec := make([]float32, len(data)/4)
+	for i := range vec {
+		vec[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:]))
+	}
+	return vec, true
+}
+
+// checkEmbeddingDim rejects a vector whose length differs from the dim of
+// the collection it is searched in or inserted into.
+func checkEmbeddingDim(vec []float32, dim int64) error {
+	if int64(len(vec)) != dim {
+		return fmt.Errorf("%w: embedding dim %d does not match collection dim %d", errDimMismatch, len(vec), dim)
+	}
+	return nil
+}
+
+// readImageDataURL reads an image file into a base64 data URL.
+func readImageDataURL(path string) (string, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", err
+	}
+	mimeType := mime.TypeByExtension(strings.ToLower(filepath.Ext(path)))
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+	encoded := base64.StdEncoding.EncodeToString(data)
+	return "data:" + mimeType + ";base64," + encoded, encoded, nil
+}
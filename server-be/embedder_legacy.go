@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// legacyEmbedder talks to the bundled FastAPI embedding server
+// (model/model_embed_online.py), which reads uploaded images from the shared
+// uploads folder and answers {"embedding": [0.1, 0.2]}, or the older
+// {"embedding": "[0.1 0.2]"}.
+type legacyEmbedder struct {
+	url    string
+	apikey string
+}
+
+// legacyNoBatch holds the urls of the servers that answered 404 on
+// /get_img_vecs. Embedders are built per request, so the answer is kept here
+// and older servers are not asked again until the next restart.
+var legacyNoBatch sync.Map
+
+type ParamImgInfo struct {
+	Url    string `json:"url"`
+	Apikey string `json:"api_key"`
+}
+type ParamTextInfo struct {
+	Data   string `json:"data"`
+	Apikey string `json:"api_key"`
+}
+type ParamImgsInfo struct {
+	Urls   []string `json:"urls"`
+	Apikey string   `json:"api_key"`
+}
+type RespInfo struct {
+	// Embedding is a JSON array of numbers, a base64 string of little-endian
+	// float32 values or the legacy "[0.1 0.2]" string.
+	Embedding interface{} `json:"embedding"`
+}
+type RespsInfo struct {
+	Embeddings []interface{} `json:"embeddings"`
+}
+
+// stringToFloat32Slice parses the legacy "[0.1 0.2]" embedding string. Any
+// run of spaces, newlines, tabs or commas separates values, so numpy's
+// wrapped and padded array2string output is accepted as well.
+func stringToFloat32Slice(str string) ([]float32, error) {
+	str1 := strings.Replace(str, "[", "", -1)
+	str2 := strings.Replace(str1, "]", "", -1)
+	parts := strings.FieldsFunc(str2, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	result := make([]float32, 0, len(parts))
+	for _, part := range parts {
+		if f64, err := strconv.ParseFloat(part, 32); err == nil {
+			result = append(result, float32(f64))
+		} else {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// uploadsRelativePath returns path relative to the working directory shared
+// with the embedding server, starting at the uploads folder.
+func uploadsRelativePath(path string) (string, error) {
+	index := strings.Index(path, uploadServerPath)
+	if index == -1 {
+		return "", errors.New("url path err")
+	}
+	return path[index:], nil
+}
+
+func (e *legacyEmbedder) EmbedImage(ctx context.Context, path string) ([]float32, error) {
+	url, err := uploadsRelativePath(path)
+	if err != nil {
+		return nil, err
+	}
+	paramBytes, err := json.Marshal(ParamImgInfo{Url: url, Apikey: e.apikey})
+	if err != nil {
+		return nil, err
+	}
+	var respInfo RespInfo
+	if err := postJSON(ctx, e.url+"/get_img_vec", nil, paramBytes, &respInfo); err != nil {
+		return nil, err
+	}
+	return parseEmbeddingValue(respInfo.Embedding)
+}
+
+// EmbedImages posts the whole batch to /get_img_vecs, which answers
+// {"embeddings": [[0.1, 0.2], ...]} in request order. Servers predating the
+// batch endpoint are called once per image instead.
+func (e *legacyEmbedder) EmbedImages(ctx context.Context, paths []string) ([][]float32, error) {
+	if _, ok := legacyNoBatch.Load(e.url); ok {
+		return embedImagesOneByOne(ctx, e, paths)
+	}
+	urls := make([]string, 0, len(paths))
+	for _, path := range paths {
+		url, err := uploadsRelativePath(path)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+	paramBytes, err := json.Marshal(ParamImgsInfo{Urls: urls, Apikey: e.apikey})
+	if err != nil {
+		return nil, err
+	}
+	var respInfo RespsInfo
+	err = postJSON(ctx, e.url+"/get_img_vecs", nil, paramBytes, &respInfo)
+	var statusErr *embedStatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		log.Printf(msgFmt, "embed server has no /get_img_vecs, embedding images one by one")
+		legacyNoBatch.Store(e.url, true)
+		return embedImagesOneByOne(ctx, e, paths)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(respInfo.Embeddings) != len(paths) {
+		return nil, fmt.Errorf("embed server returned %d embeddings for %d images", len(respInfo.Embeddings), len(paths))
+	}
+	vecs := make([][]float32, 0, len(paths))
+	for i, embedding := range respInfo.Embeddings {
+		vec, err := parseEmbeddingValue(embedding)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", paths[i], err)
+		}
+		vecs = append(vecs, vec)
+	}
+	return vecs, nil
+}
+
+func (e *legacyEmbedder) EmbedText(ctx context.Context, text string) ([]float32, error) {
+	paramBytes, err := json.Marshal(ParamTextInfo{Data: text, Apikey: e.apikey})
+	if err != nil {
+		return nil, err
+	}
+	var respInfo RespInfo
+	if err := postJSON(ctx, e.url+"/get_txt_vec", nil, paramBytes, &respInfo); err != nil {
+		return nil, err
+	}
+	return parseEmbeddingValue(respInfo.Embedding)
+}
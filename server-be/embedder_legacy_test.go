@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestLegacyEmbedderNoBatch(t *testing.T) {
+	var batchCalls, singleCalls atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/get_img_vecs", func(w http.ResponseWriter, r *http.Request) {
+		batchCalls.Add(1)
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("/get_img_vec", func(w http.ResponseWriter, r *http.Request) {
+		singleCalls.Add(1)
+		json.NewEncoder(w).Encode(map[string]interface{}{"embedding": []float32{1, 2}})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	paths := []string{"uploads/pets/a.png", "uploads/pets/b.png"}
+	// Each import builds its own embedder; the old server is only probed once.
+	for i := 0; i < 2; i++ {
+		embedder, err := newEmbedder(EmbedderConfig{Url: server.URL})
+		if err != nil {
+			t.Fatal(err)
+		}
+		vecs, err := embedder.EmbedImages(context.Background(), paths)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(vecs) != 2 || len(vecs[1]) != 2 {
+			t.Fatalf("embeddings: got %v", vecs)
+		}
+	}
+	if got := batchCalls.Load(); got != 1 {
+		t.Errorf("calls to /get_img_vecs: got %d, want 1", got)
+	}
+	if got := singleCalls.Load(); got != 4 {
+		t.Errorf("calls to /get_img_vec: got %d, want 4", got)
+	}
+}
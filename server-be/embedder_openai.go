@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// openAIEmbedder calls an OpenAI compatible POST /v1/embeddings endpoint.
+// Images are sent as base64 data URLs, which multimodal servers implementing
+// this API accept in place of text input.
+type openAIEmbedder struct {
+	endpoint string
+	apikey   string
+	model    string
+}
+
+type openAIEmbeddingRequest struct {
+	Model string      `json:"model,omitempty"`
+	Input interface{} `json:"input"`
+}
+
+type openAIEmbeddingResponse struct {
+	Data []struct {
+		Index     int         `json:"index"`
+		Embedding interface{} `json:"embedding"`
+	} `json:"data"`
+}
+
+// newOpenAIEmbedder accepts either the API base URL (http://host/v1) or the
+// full embeddings endpoint.
+func newOpenAIEmbedder(cfg EmbedderConfig) *openAIEmbedder {
+	endpoint := strings.TrimRight(cfg.Url, "/")
+	if !strings.HasSuffix(endpoint, "/embeddings") {
+		if !strings.HasSuffix(endpoint, "/v1") {
+			endpoint += "/v1"
+		}
+		endpoint += "/embeddings"
+	}
+	return &openAIEmbedder{endpoint: endpoint, apikey: cfg.ApiKey, model: cfg.Model}
+}
+
+// embed sends inputs in one request and returns their vectors in order.
+func (e *openAIEmbedder) embed(ctx context.Context, inputs []string) ([][]float32, error) {
+	paramBytes, err := json.Marshal(openAIEmbeddingRequest{Model: e.model, Input: inputs})
+	if err != nil {
+		return nil, err
+	}
+	headers := map[string]string{}
+	if e.apikey != "" {
+		headers["Authorization"] = "Bearer " + e.apikey
+	}
+	var resp openAIEmbeddingResponse
+	if err := postJSON(ctx, e.endpoint, headers, paramBytes, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Data) != len(inputs) {
+		return nil, fmt.Errorf("embed server returned %d embeddings for %d inputs", len(resp.Data), len(inputs))
+	}
+	vecs := make([][]float32, len(inputs))
+	for _, item := range resp.Data {
+		if item.Index < 0 || item.Index >= len(vecs) || vecs[item.Index] != nil {
+			return nil, fmt.Errorf("embed server returned an invalid index %d", item.Index)
+		}
+		vec, err := parseEmbeddingValue(item.Embedding)
+		if err != nil {
+			return nil, err
+		}
+		vecs[item.Index] = vec
+	}
+	return vecs, nil
+}
+
+func (e *openAIEmbedder) EmbedImage(ctx context.Context, path string) ([]float32, error) {
+	vecs, err := e.EmbedImages(ctx, []string{path})
+	if err != nil {
+		return nil, err
+	}
+	return vecs[0], nil
+}
+
+func (e *openAIEmbedder) EmbedImages(ctx context.Context, paths []string) ([][]float32, error) {
+	inputs := make([]string, 0, len(paths))
+	for _, path := range paths {
+		dataURL, _, err := readImageDataURL(path)
+		if err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, dataURL)
+	}
+	return e.embed(ctx, inputs)
+}
+
+func (e *openAIEmbedder) EmbedText(ctx context.Context, text string) ([]float32, error) {
+	vecs, err := e.embed(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return vecs[0], nil
+}
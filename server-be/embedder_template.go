@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// templateEmbedder posts a user supplied JSON body to a generic HTTP embedding
+// service and picks the vector out of the response with a dot path. The
+// templates may use these placeholders, which are replaced by JSON escaped
+// values and so belong inside string literals:
+//
+//	{{text}}            the search text
+//	{{image_path}}      the image path relative to the working directory
+//	{{image_base64}}    the raw base64 encoded image
+//	{{image_data_url}}  the image as a data:<mime>;base64,... URL
+//	{{api_key}}         the configured api key
+//	{{model}}           the configured model name
+type templateEmbedder struct {
+	url           string
+	apikey        string
+	model         string
+	textTemplate  string
+	imageTemplate string
+	responsePath  []string
+}
+
+const (
+	defaultTextTemplate  = `{"input": "{{text}}", "model": "{{model}}"}`
+	defaultImageTemplate = `{"input": "{{image_data_url}}", "model": "{{model}}"}`
+	defaultResponsePath  = "data.0.embedding"
+)
+
+func newTemplateEmbedder(cfg EmbedderConfig) (*templateEmbedder, error) {
+	e := &templateEmbedder{
+		url:           cfg.Url,
+		apikey:        cfg.ApiKey,
+		model:         cfg.Model,
+		textTemplate:  cfg.TextTemplate,
+		imageTemplate: cfg.ImageTemplate,
+	}
+	if e.textTemplate == "" {
+		e.textTemplate = defaultTextTemplate
+	}
+	if e.imageTemplate == "" {
+		e.imageTemplate = defaultImageTemplate
+	}
+	responsePath := cfg.ResponsePath
+	if responsePath == "" {
+		responsePath = defaultResponsePath
+	}
+	e.responsePath = strings.Split(responsePath, ".")
+
+	// Render both templates once so that a broken template is reported when
+	// the instance is configured rather than on the first request.
+	for _, tmpl := range []string{e.textTemplate, e.imageTemplate} {
+		if _, err := e.render(tmpl, map[string]string{}); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// render substitutes the placeholders of tmpl and checks that the result is
+// valid JSON.
+func (e *templateEmbedder) render(tmpl string, values map[string]string) ([]byte, error) {
+	values["api_key"] = e.apikey
+	values["model"] = e.model
+	out := tmpl
+	for _, key := range []string{"text", "image_path", "image_base64", "image_data_url", "api_key", "model"} {
+		escaped, _ := json.Marshal(values[key])
+		out = strings.ReplaceAll(out, "{{"+key+"}}", string(escaped[1:len(escaped)-1]))
+	}
+	if !json.Valid([]byte(out)) {
+		return nil, fmt.Errorf("embed template is not valid JSON: %s", tmpl)
+	}
+	return []byte(out), nil
+}
+
+func (e *templateEmbedder) embed(ctx context.Context, tmpl string, values map[string]string) ([]float32, error) {
+	paramBytes, err := e.render(tmpl, values)
+	if err != nil {
+		return nil, err
+	}
+	var resp interface{}
+	if err := postJSON(ctx, e.url, nil, paramBytes, &resp); err != nil {
+		return nil, err
+	}
+	value, err := lookupJSONPath(resp, e.responsePath)
+	if err != nil {
+		return nil, err
+	}
+	return parseEmbeddingValue(value)
+}
+
+func (e *templateEmbedder) EmbedImage(ctx context.Context, path string) ([]float32, error) {
+	dataURL, encoded, err := readImageDataURL(path)
+	if err != nil {
+		return nil, err
+	}
+	return e.embed(ctx, e.imageTemplate, map[string]string{
+		"image_path":     path,
+		"image_base64":   encoded,
+		"image_data_url": dataURL,
+	})
+}
+
+func (e *templateEmbedder) EmbedImages(ctx context.Context, paths []string) ([][]float32, error) {
+	return embedImagesOneByOne(ctx, e, paths)
+}
+
+func (e *templateEmbedder) EmbedText(ctx context.Context, text string) ([]float32, error) {
+	return e.embed(ctx, e.textTemplate, map[string]string{"text": text})
+}
+
+// lookupJSONPath walks a decoded JSON document along path, where numeric
+// elements index into arrays.
+func lookupJSONPath(doc interface{}, path []string) (interface{}, error) {
+	cur := doc
+	for i, key := range path {
+		switch node := cur.(type) {
+		case map[string]interface{}:
+			v, ok := node[key]
+			if !ok {
+				return nil, fmt.Errorf("response has no %q", strings.Join(path[:i+1], "."))
+			}
+			cur = v
+		case []interface{}:
+			idx, err := strconv.Atoi(key)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return nil, fmt.Errorf("response has no %q", strings.Join(path[:i+1], "."))
+			}
+			cur = node[idx]
+		default:
+			return nil, fmt.Errorf("response has no %q", strings.Join(path[:i+1], "."))
+		}
+	}
+	return cur, nil
+}
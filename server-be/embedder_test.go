@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOpenAIEmbedder(t *testing.T) {
+	var inputs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/embeddings" || r.Header.Get("Authorization") != "Bearer key" {
+			http.Error(w, "bad request to "+r.URL.Path, http.StatusBadRequest)
+			return
+		}
+		var req struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Model != "clip" {
+			http.Error(w, "bad model", http.StatusBadRequest)
+			return
+		}
+		inputs = append(inputs, req.Input...)
+		// Answer in reverse order; the index tells which input is which.
+		var resp openAIEmbeddingResponse
+		for i := len(req.Input) - 1; i >= 0; i-- {
+			resp.Data = append(resp.Data, struct {
+				Index     int         `json:"index"`
+				Embedding interface{} `json:"embedding"`
+			}{i, []float32{float32(i), 1.5}})
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "cat.png"), filepath.Join(dir, "dog.png")}
+	os.WriteFile(paths[0], []byte("a cat"), 0o644)
+	os.WriteFile(paths[1], []byte("a dog"), 0o644)
+	embedder, err := newEmbedder(EmbedderConfig{Provider: embedProviderOpenAI, Url: server.URL, ApiKey: "key", Model: "clip"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if vec, err := embedder.EmbedText(ctx, "a dog"); err != nil || len(vec) != 2 || vec[1] != 1.5 {
+		t.Fatalf("text embedding: got %v, %v", vec, err)
+	}
+	vecs, err := embedder.EmbedImages(ctx, paths)
+	if err != nil || len(vecs) != 2 || vecs[0][0] != 0 || vecs[1][0] != 1 {
+		t.Fatalf("image embeddings: got %v, %v", vecs, err)
+	}
+	if len(inputs) != 3 || inputs[0] != "a dog" || inputs[1] != "data:image/png;base64,YSBjYXQ=" {
+		t.Errorf("inputs: got %q", inputs)
+	}
+}
+
+func TestTemplateEmbedder(t *testing.T) {
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Write([]byte(`{"result": {"vectors": [[1, 2, 3]]}}`))
+	}))
+	defer server.Close()
+
+	embedder, err := newEmbedder(EmbedderConfig{
+		Provider:     embedProviderTemplate,
+		Url:          server.URL,
+		ApiKey:       "key",
+		TextTemplate: `{"query": "{{text}}", "token": "{{api_key}}"}`,
+		ResponsePath: "result.vectors.0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vec, err := embedder.EmbedText(context.Background(), `a "quoted" dog`)
+	if err != nil || len(vec) != 3 || vec[2] != 3 {
+		t.Fatalf("embedding: got %v, %v", vec, err)
+	}
+	// Placeholders are JSON escaped.
+	if body["query"] != `a "quoted" dog` || body["token"] != "key" {
+		t.Errorf("request body: got %v", body)
+	}
+}
+
+func TestNewEmbedderErrors(t *testing.T) {
+	for _, cfg := range []EmbedderConfig{
+		{Url: ""},
+		{Provider: "nope", Url: "http://localhost"},
+		{Provider: embedProviderTemplate, Url: "http://localhost", TextTemplate: `{"input": {{text}}}`},
+	} {
+		if _, err := newEmbedder(cfg); err == nil {
+			t.Errorf("newEmbedder(%+v): no error", cfg)
+		}
+	}
+}
+
+func TestEmbedServerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "model not loaded", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	embedder, err := newEmbedder(EmbedderConfig{Url: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := embedder.EmbedText(context.Background(), "a dog"); err == nil || !strings.Contains(err.Error(), "model not loaded") {
+		t.Errorf("error: got %v, want the body of the answer", err)
+	}
+}
+
+func TestParseEmbeddingValue(t *testing.T) {
+	for _, tc := range []struct {
+		value interface{}
+		want  []float32
+	}{
+		{[]interface{}{0.5, -1.0}, []float32{0.5, -1}},
+		{"[0.5 -1]", []float32{0.5, -1}},
+		{"[ 0.5,\n  -1e0 ]", []float32{0.5, -1}},
+		// 0.5 and -1 as little-endian float32.
+		{"AAAAPwAAgL8=", []float32{0.5, -1}},
+	} {
+		vec, err := parseEmbeddingValue(tc.value)
+		if err != nil || len(vec) != len(tc.want) || vec[0] != tc.want[0] || vec[1] != tc.want[1] {
+			t.Errorf("parseEmbeddingValue(%q): got %v, %v", tc.value, vec, err)
+		}
+	}
+	for _, value := range []interface{}{nil, "", "[]", "[0.5 x]", []interface{}{0.5, "1"}, map[string]interface{}{}, "AADAfw=="} {
+		if vec, err := parseEmbeddingValue(value); err == nil {
+			t.Errorf("parseEmbeddingValue(%q): got %v, want an error", value, vec)
+		}
+	}
+}
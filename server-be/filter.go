@@ -0,0 +1,530 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var errInvalidFilter = errors.New("invalid filter")
+
+// filterExpr is a compiled search filter. It is evaluated against the fields
+// of a row: id, url, hash and the metadata fields.
+type filterExpr interface {
+	eval(row map[string]interface{}) interface{}
+}
+
+// compileFilter parses the subset of the Milvus boolean expression language
+// the local store supports:
+//
+//	album == "cars" and upload_time >= 1700000000
+//	width > 1000 or not (mime_type in ["image/png", "image/gif"])
+//	source like "camera%" && array_contains(tags, "red")
+//	extra["color"] == "red"
+//
+// with the functions array_contains, array_contains_all, array_contains_any,
+// array_length and json_contains. fields are the names a filter may use.
+func compileFilter(expr string, fields map[string]bool) (filterExpr, error) {
+	p := &filterParser{fields: fields}
+	if err := p.tokenize(expr); err != nil {
+		return nil, fmt.Errorf("%w: %s", errInvalidFilter, err.Error())
+	}
+	e, err := p.parseOr()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errInvalidFilter, err.Error())
+	}
+	return e, nil
+}
+
+// filterIn returns the filter matching the rows whose field is one of
+// values, quoting them as the Milvus expression language and the local
+// parser expect.
+func filterIn(field string, values []string) string {
+	quoted := make([]string, 0, len(values))
+	for _, value := range values {
+		quoted = append(quoted, `"`+strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value)+`"`)
+	}
+	return field + " in [" + strings.Join(quoted, ", ") + "]"
+}
+
+// matchFilter reports whether row passes e. A nil filter passes every row.
+func matchFilter(e filterExpr, row map[string]interface{}) bool {
+	if e == nil {
+		return true
+	}
+	ok, _ := e.eval(row).(bool)
+	return ok
+}
+
+const (
+	tokenIdent = iota
+	tokenNumber
+	tokenString
+	tokenOp
+)
+
+type filterToken struct {
+	kind int
+	text string
+	num  float64
+}
+
+type filterParser struct {
+	fields map[string]bool
+	tokens []filterToken
+	pos    int
+}
+
+var compareOps = map[string]bool{"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true}
+
+var filterOps = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ","}
+
+func (p *filterParser) tokenize(expr string) error {
+	for i := 0; i < len(expr); {
+		c := rune(expr[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"' || c == '\'':
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(expr) && rune(expr[j]) != c; j++ {
+				if expr[j] == '\\' && j+1 < len(expr) {
+					j++
+				}
+				sb.WriteByte(expr[j])
+			}
+			if j == len(expr) {
+				return errors.New("unterminated string")
+			}
+			p.tokens = append(p.tokens, filterToken{kind: tokenString, text: sb.String()})
+			i = j + 1
+		case unicode.IsDigit(c) || (c == '-' && i+1 < len(expr) && unicode.IsDigit(rune(expr[i+1]))):
+			j := i + 1
+			for j < len(expr) && (unicode.IsDigit(rune(expr[j])) || strings.ContainsRune(".eE", rune(expr[j])) ||
+				((expr[j] == '-' || expr[j] == '+') && (expr[j-1] == 'e' || expr[j-1] == 'E'))) {
+				j++
+			}
+			num, err := strconv.ParseFloat(expr[i:j], 64)
+			if err != nil {
+				return fmt.Errorf("invalid number %q", expr[i:j])
+			}
+			p.tokens = append(p.tokens, filterToken{kind: tokenNumber, text: expr[i:j], num: num})
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i + 1
+			for j < len(expr) && (unicode.IsLetter(rune(expr[j])) || unicode.IsDigit(rune(expr[j])) || expr[j] == '_') {
+				j++
+			}
+			p.tokens = append(p.tokens, filterToken{kind: tokenIdent, text: expr[i:j]})
+			i = j
+		default:
+			matched := false
+			for _, op := range filterOps {
+				if strings.HasPrefix(expr[i:], op) {
+					p.tokens = append(p.tokens, filterToken{kind: tokenOp, text: op})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return fmt.Errorf("unexpected character %q", c)
+			}
+		}
+	}
+	if len(p.tokens) == 0 {
+		return errors.New("empty expression")
+	}
+	return nil
+}
+
+func (p *filterParser) peek() filterToken {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return filterToken{kind: -1}
+}
+
+// accept consumes the next token if it is the operator or keyword text.
+// Keywords are matched case-insensitively.
+func (p *filterParser) accept(texts ...string) bool {
+	t := p.peek()
+	if t.kind != tokenOp && t.kind != tokenIdent {
+		return false
+	}
+	for _, text := range texts {
+		if t.text == text || (t.kind == tokenIdent && strings.EqualFold(t.text, text)) {
+			p.pos++
+			return true
+		}
+	}
+	return false
+}
+
+func (p *filterParser) expect(text string) error {
+	if !p.accept(text) {
+		if p.pos >= len(p.tokens) {
+			return fmt.Errorf("expected %q at end of expression", text)
+		}
+		return fmt.Errorf("expected %q before %q", text, p.peek().text)
+	}
+	return nil
+}
+
+func (p *filterParser) parseOr() (filterExpr, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.accept("||", "or") {
+		var right filterExpr
+		right, err = p.parseAnd()
+		left = logicExpr{or: true, left: left, right: right}
+	}
+	return left, err
+}
+
+func (p *filterParser) parseAnd() (filterExpr, error) {
+	left, err := p.parseNot()
+	for err == nil && p.accept("&&", "and") {
+		var right filterExpr
+		right, err = p.parseNot()
+		left = logicExpr{left: left, right: right}
+	}
+	return left, err
+}
+
+func (p *filterParser) parseNot() (filterExpr, error) {
+	if p.accept("!", "not") {
+		e, err := p.parseNot()
+		return notExpr{e}, err
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (filterExpr, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	switch {
+	case t.kind == tokenOp && compareOps[t.text]:
+		p.pos++
+		right, err := p.parseOperand()
+		return compareExpr{op: t.text, left: left, right: right}, err
+	case p.accept("in"):
+		right, err := p.parseOperand()
+		return inExpr{value: left, list: right}, err
+	case p.accept("not"):
+		if err := p.expect("in"); err != nil {
+			return nil, err
+		}
+		right, err := p.parseOperand()
+		return notExpr{inExpr{value: left, list: right}}, err
+	case p.accept("like"):
+		pattern := p.peek()
+		if pattern.kind != tokenString {
+			return nil, errors.New("like needs a string pattern")
+		}
+		p.pos++
+		return likeExpr{value: left, pattern: likePattern(pattern.text)}, nil
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseOperand() (filterExpr, error) {
+	t := p.peek()
+	switch {
+	case t.kind == tokenNumber:
+		p.pos++
+		return literalExpr{t.num}, nil
+	case t.kind == tokenString:
+		p.pos++
+		return literalExpr{t.text}, nil
+	case p.accept("("):
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expect(")")
+	case p.accept("["):
+		var list []filterExpr
+		for !p.accept("]") {
+			if len(list) > 0 {
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+			item, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+		return listExpr(list), nil
+	case t.kind == tokenIdent:
+		p.pos++
+		switch strings.ToLower(t.text) {
+		case "true", "false":
+			return literalExpr{strings.EqualFold(t.text, "true")}, nil
+		}
+		if p.accept("(") {
+			return p.parseCall(strings.ToLower(t.text))
+		}
+		if !p.fields[t.text] {
+			return nil, fmt.Errorf("unknown field %q", t.text)
+		}
+		var e filterExpr = fieldExpr(t.text)
+		for p.accept("[") {
+			key := p.peek()
+			if key.kind != tokenString && key.kind != tokenNumber {
+				return nil, errors.New("expected a key in []")
+			}
+			p.pos++
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			e = indexExpr{value: e, key: key.text}
+		}
+		return e, nil
+	}
+	if p.pos >= len(p.tokens) {
+		return nil, errors.New("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q", t.text)
+}
+
+func (p *filterParser) parseCall(name string) (filterExpr, error) {
+	var args []filterExpr
+	for !p.accept(")") {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	want := 2
+	switch name {
+	case "array_length":
+		want = 1
+	case "array_contains", "array_contains_all", "array_contains_any", "json_contains":
+	default:
+		return nil, fmt.Errorf("unknown function %q", name)
+	}
+	if len(args) != want {
+		return nil, fmt.Errorf("%s takes %d arguments", name, want)
+	}
+	return callExpr{name: name, args: args}, nil
+}
+
+// likePattern turns a like pattern, where % matches any text and _ one
+// character, into a regexp.
+func likePattern(pattern string) *regexp.Regexp {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for _, c := range pattern {
+		switch c {
+		case '%':
+			sb.WriteString(".*")
+		case '_':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.MustCompile(sb.String())
+}
+
+type literalExpr struct{ value interface{} }
+
+func (e literalExpr) eval(map[string]interface{}) interface{} { return e.value }
+
+type fieldExpr string
+
+func (e fieldExpr) eval(row map[string]interface{}) interface{} { return normalize(row[string(e)]) }
+
+type listExpr []filterExpr
+
+func (e listExpr) eval(row map[string]interface{}) interface{} {
+	values := make([]interface{}, 0, len(e))
+	for _, item := range e {
+		values = append(values, item.eval(row))
+	}
+	return values
+}
+
+type indexExpr struct {
+	value filterExpr
+	key   string
+}
+
+func (e indexExpr) eval(row map[string]interface{}) interface{} {
+	switch v := e.value.eval(row).(type) {
+	case map[string]interface{}:
+		return normalize(v[e.key])
+	case []interface{}:
+		i, err := strconv.Atoi(e.key)
+		if err == nil && i >= 0 && i < len(v) {
+			return normalize(v[i])
+		}
+	}
+	return nil
+}
+
+type logicExpr struct {
+	or          bool
+	left, right filterExpr
+}
+
+func (e logicExpr) eval(row map[string]interface{}) interface{} {
+	left, _ := e.left.eval(row).(bool)
+	if left == e.or {
+		return left
+	}
+	right, _ := e.right.eval(row).(bool)
+	return right
+}
+
+type notExpr struct{ e filterExpr }
+
+func (e notExpr) eval(row map[string]interface{}) interface{} {
+	ok, _ := e.e.eval(row).(bool)
+	return !ok
+}
+
+type compareExpr struct {
+	op          string
+	left, right filterExpr
+}
+
+func (e compareExpr) eval(row map[string]interface{}) interface{} {
+	cmp, ok := compareValues(e.left.eval(row), e.right.eval(row))
+	if !ok {
+		return e.op == "!="
+	}
+	switch e.op {
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+type inExpr struct{ value, list filterExpr }
+
+func (e inExpr) eval(row map[string]interface{}) interface{} {
+	list, _ := e.list.eval(row).([]interface{})
+	return containsValue(list, e.value.eval(row))
+}
+
+type likeExpr struct {
+	value   filterExpr
+	pattern *regexp.Regexp
+}
+
+func (e likeExpr) eval(row map[string]interface{}) interface{} {
+	s, ok := e.value.eval(row).(string)
+	return ok && e.pattern.MatchString(s)
+}
+
+type callExpr struct {
+	name string
+	args []filterExpr
+}
+
+func (e callExpr) eval(row map[string]interface{}) interface{} {
+	array, _ := e.args[0].eval(row).([]interface{})
+	switch e.name {
+	case "array_length":
+		return float64(len(array))
+	case "array_contains", "json_contains":
+		return containsValue(array, e.args[1].eval(row))
+	}
+	want, _ := e.args[1].eval(row).([]interface{})
+	for _, value := range want {
+		found := containsValue(array, value)
+		if e.name == "array_contains_any" && found {
+			return true
+		}
+		if e.name == "array_contains_all" && !found {
+			return false
+		}
+	}
+	return e.name == "array_contains_all"
+}
+
+// normalize turns the values of a row into the types filters work on:
+// float64 numbers and []interface{} lists.
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int64:
+		return float64(v)
+	case int:
+		return float64(v)
+	case []string:
+		list := make([]interface{}, 0, len(v))
+		for _, s := range v {
+			list = append(list, s)
+		}
+		return list
+	}
+	return value
+}
+
+// compareValues orders two numbers, strings or booleans. ok is false when
+// they cannot be compared.
+func compareValues(a, b interface{}) (int, bool) {
+	switch a := a.(type) {
+	case float64:
+		if b, ok := b.(float64); ok {
+			switch {
+			case a < b:
+				return -1, true
+			case a > b:
+				return 1, true
+			}
+			return 0, true
+		}
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b), true
+		}
+	case bool:
+		if b, ok := b.(bool); ok {
+			if a == b {
+				return 0, true
+			}
+			return 1, true
+		}
+	}
+	return 0, false
+}
+
+func containsValue(list []interface{}, value interface{}) bool {
+	for _, item := range list {
+		if cmp, ok := compareValues(normalize(item), value); ok && cmp == 0 {
+			return true
+		}
+	}
+	return false
+}
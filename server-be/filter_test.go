@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+var filterTestFields = map[string]bool{"id": true, "url": true, "album": true, "width": true, "tags": true, "extra": true}
+
+func filterTestRow() map[string]interface{} {
+	return map[string]interface{}{
+		"id":    int64(7),
+		"url":   "uploads/pets/cat_01.png",
+		"album": "cats",
+		"width": int64(1200),
+		"tags":  []string{"red", "small"},
+		"extra": map[string]interface{}{
+			"color": "red",
+			"size":  float64(3),
+			"owner": map[string]interface{}{"name": "ann"},
+			"sizes": []interface{}{float64(1), float64(2)},
+		},
+	}
+}
+
+func TestMatchFilter(t *testing.T) {
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		// Comparisons.
+		{`album == "cats"`, true},
+		{`album != "cats"`, false},
+		{`width > 1000`, true},
+		{`width >= 1200 && width <= 1200`, true},
+		{`width < 1000`, false},
+		{`id == 7`, true},
+		{`album == 'cats'`, true},
+		{`album < "dogs"`, true},
+		{`width == "1200"`, false},
+
+		// not binds tighter than and, and tighter than or.
+		{`album == "dogs" or album == "cats" and width > 2000`, false},
+		{`(album == "dogs" or album == "cats") and width > 1000`, true},
+		{`album == "cats" or album == "dogs" and width > 2000`, true},
+		{`not album == "dogs" and width > 1000`, true},
+		{`!(album == "cats" || width > 2000)`, false},
+		{`NOT album == "dogs" AND width > 1000`, true},
+		{`not not album == "cats"`, true},
+
+		// in and not in.
+		{`album in ["cats", "dogs"]`, true},
+		{`album in ["dogs"]`, false},
+		{`album not in ["dogs", "birds"]`, true},
+		{`album not in ["cats"]`, false},
+		{`width in [1200, 800]`, true},
+		{`album in []`, false},
+
+		// like, with % for any text and _ for one character.
+		{`url like "uploads/pets/%"`, true},
+		{`url like "%.png"`, true},
+		{`url like "%cat_0_.png"`, true},
+		{`url like "uploads/pets/cat_0.png"`, false},
+		{`url like "cat%"`, false},
+		{`url like "%.p.g"`, false},
+
+		// JSON access.
+		{`extra["color"] == "red"`, true},
+		{`extra["size"] > 2`, true},
+		{`extra["owner"]["name"] == "ann"`, true},
+		{`extra["sizes"][1] == 2`, true},
+		{`extra["sizes"][5] == 2`, false},
+		{`extra["missing"] == "red"`, false},
+		{`json_contains(extra["sizes"], 1)`, true},
+		{`json_contains(extra["sizes"], 3)`, false},
+
+		// Array functions.
+		{`array_contains(tags, "red")`, true},
+		{`array_contains(tags, "blue")`, false},
+		{`array_contains_all(tags, ["red", "small"])`, true},
+		{`array_contains_all(tags, ["red", "blue"])`, false},
+		{`array_contains_any(tags, ["blue", "small"])`, true},
+		{`array_contains_any(tags, ["blue", "green"])`, false},
+		{`array_contains_all(tags, [])`, true},
+		{`array_length(tags) == 2`, true},
+		{`ARRAY_CONTAINS(tags, "red") and not array_contains(tags, "big")`, true},
+	}
+	row := filterTestRow()
+	for _, tt := range tests {
+		e, err := compileFilter(tt.expr, filterTestFields)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		if got := matchFilter(e, row); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+
+	if !matchFilter(nil, row) {
+		t.Error("nil filter: got false, want true")
+	}
+}
+
+func TestCompileFilterErrors(t *testing.T) {
+	for _, expr := range []string{
+		``,
+		`   `,
+		`nope == 1`,
+		`album ==`,
+		`album == "cats`,
+		`(album == "cats"`,
+		`album == "cats")`,
+		`album like 1`,
+		`album not "cats"`,
+		`array_contains(tags)`,
+		`array_length(tags, 1)`,
+		`frobnicate(tags)`,
+		`extra[color] == 1`,
+		`album == "cats" album`,
+		`album @ "cats"`,
+		`album in ["cats" "dogs"]`,
+	} {
+		if _, err := compileFilter(expr, filterTestFields); !errors.Is(err, errInvalidFilter) {
+			t.Errorf("%q: got %v, want an invalid filter error", expr, err)
+		}
+	}
+}
+
+func TestFilterIn(t *testing.T) {
+	expr := filterIn("url", []string{`a"b`, `c\d`, "e"})
+	e, err := compileFilter(expr, filterTestFields)
+	if err != nil {
+		t.Fatalf("%s: %v", expr, err)
+	}
+	for url, want := range map[string]bool{`a"b`: true, `c\d`: true, "e": true, "f": false} {
+		if got := matchFilter(e, map[string]interface{}{"url": url}); got != want {
+			t.Errorf("%s on %q: got %v, want %v", expr, url, got, want)
+		}
+	}
+}
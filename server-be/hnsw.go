@@ -0,0 +1,227 @@
+package main
+
+import (
+	"container/heap"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// hnswGraph is a Hierarchical Navigable Small World graph (Malkov & Yashunin)
+// used by the local vector store for approximate nearest neighbour search.
+// Nodes are numbered by insertion order; the graph does not own the vectors,
+// they are looked up through an hnswSpace so that the index and the collection
+// rows share the same memory. Exported fields are persisted with gob.
+type hnswGraph struct {
+	M              int
+	EfConstruction int
+	EntryPoint     int32
+	MaxLevel       int
+	// Links holds, for every node, its neighbour list on each of its levels.
+	Links [][][]int32
+}
+
+// hnswSpace gives the graph access to node vectors and to the distance
+// function, where a lower distance is a better match.
+type hnswSpace struct {
+	vector   func(node int32) []float32
+	distance func(a, b []float32) float32
+}
+
+func newHNSWGraph(m, efConstruction int) *hnswGraph {
+	if m < 2 {
+		m = 2
+	}
+	if efConstruction < m {
+		efConstruction = m
+	}
+	return &hnswGraph{M: m, EfConstruction: efConstruction, EntryPoint: -1}
+}
+
+// Len returns the number of nodes in the graph.
+func (g *hnswGraph) Len() int {
+	return len(g.Links)
+}
+
+func (g *hnswGraph) maxLinks(level int) int {
+	if level == 0 {
+		return 2 * g.M
+	}
+	return g.M
+}
+
+func (g *hnswGraph) randomLevel(rnd *rand.Rand) int {
+	levelMult := 1 / math.Log(float64(g.M))
+	return int(math.Floor(-math.Log(1-rnd.Float64()) * levelMult))
+}
+
+// Add inserts the next node, whose vector must already be reachable through
+// space.vector(int32(g.Len())).
+func (g *hnswGraph) Add(space hnswSpace, rnd *rand.Rand) {
+	node := int32(len(g.Links))
+	level := g.randomLevel(rnd)
+	g.Links = append(g.Links, make([][]int32, level+1))
+	if g.EntryPoint < 0 {
+		g.EntryPoint = node
+		g.MaxLevel = level
+		return
+	}
+
+	q := space.vector(node)
+	ep := []hnswCandidate{{node: g.EntryPoint, dist: space.distance(q, space.vector(g.EntryPoint))}}
+	for lc := g.MaxLevel; lc > level; lc-- {
+		ep = g.searchLayer(space, q, ep, 1, lc)
+	}
+	for lc := min(level, g.MaxLevel); lc >= 0; lc-- {
+		found := g.searchLayer(space, q, ep, g.EfConstruction, lc)
+		neighbours := g.selectNeighbours(space, found, g.M)
+		g.Links[node][lc] = neighbours
+		for _, nb := range neighbours {
+			g.connect(space, nb, node, lc)
+		}
+		ep = found
+	}
+	if level > g.MaxLevel {
+		g.MaxLevel = level
+		g.EntryPoint = node
+	}
+}
+
+// connect adds a link from node to target on level lc, pruning node's
+// neighbour list with the selection heuristic when it grows too long.
+func (g *hnswGraph) connect(space hnswSpace, node, target int32, lc int) {
+	links := append(g.Links[node][lc], target)
+	if len(links) <= g.maxLinks(lc) {
+		g.Links[node][lc] = links
+		return
+	}
+	v := space.vector(node)
+	candidates := make([]hnswCandidate, 0, len(links))
+	for _, nb := range links {
+		candidates = append(candidates, hnswCandidate{node: nb, dist: space.distance(v, space.vector(nb))})
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].dist < candidates[j].dist })
+	g.Links[node][lc] = g.selectNeighbours(space, candidates, g.maxLinks(lc))
+}
+
+// selectNeighbours implements the neighbour selection heuristic: a candidate
+// is kept only if it is closer to the query than to every neighbour already
+// kept, which keeps the graph navigable across clusters. Pruned candidates
+// fill the remaining slots. candidates must be sorted by ascending distance.
+func (g *hnswGraph) selectNeighbours(space hnswSpace, candidates []hnswCandidate, m int) []int32 {
+	selected := make([]int32, 0, m)
+	var pruned []int32
+	for _, c := range candidates {
+		if len(selected) >= m {
+			break
+		}
+		cv := space.vector(c.node)
+		good := true
+		for _, s := range selected {
+			if space.distance(cv, space.vector(s)) < c.dist {
+				good = false
+				break
+			}
+		}
+		if good {
+			selected = append(selected, c.node)
+		} else {
+			pruned = append(pruned, c.node)
+		}
+	}
+	for _, p := range pruned {
+		if len(selected) >= m {
+			break
+		}
+		selected = append(selected, p)
+	}
+	return selected
+}
+
+// Search returns up to ef nodes closest to q, sorted by ascending distance.
+func (g *hnswGraph) Search(space hnswSpace, q []float32, ef int) []hnswCandidate {
+	if g.EntryPoint < 0 {
+		return nil
+	}
+	ep := []hnswCandidate{{node: g.EntryPoint, dist: space.distance(q, space.vector(g.EntryPoint))}}
+	for lc := g.MaxLevel; lc > 0; lc-- {
+		ep = g.searchLayer(space, q, ep, 1, lc)
+	}
+	return g.searchLayer(space, q, ep, ef, 0)
+}
+
+// searchLayer is a best-first beam search of width ef on level lc. The result
+// is sorted by ascending distance.
+func (g *hnswGraph) searchLayer(space hnswSpace, q []float32, entry []hnswCandidate, ef int, lc int) []hnswCandidate {
+	visited := make(map[int32]bool, ef*4)
+	candidates := &hnswMinHeap{}
+	results := &hnswMaxHeap{}
+	for _, e := range entry {
+		visited[e.node] = true
+		heap.Push(candidates, e)
+		heap.Push(results, e)
+		if results.Len() > ef {
+			heap.Pop(results)
+		}
+	}
+	for candidates.Len() > 0 {
+		c := heap.Pop(candidates).(hnswCandidate)
+		if results.Len() >= ef && c.dist > (*results)[0].dist {
+			break
+		}
+		links := g.Links[c.node]
+		if lc >= len(links) {
+			continue
+		}
+		for _, nb := range links[lc] {
+			if visited[nb] {
+				continue
+			}
+			visited[nb] = true
+			d := space.distance(q, space.vector(nb))
+			if results.Len() < ef || d < (*results)[0].dist {
+				heap.Push(candidates, hnswCandidate{node: nb, dist: d})
+				heap.Push(results, hnswCandidate{node: nb, dist: d})
+				if results.Len() > ef {
+					heap.Pop(results)
+				}
+			}
+		}
+	}
+	out := make([]hnswCandidate, results.Len())
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = heap.Pop(results).(hnswCandidate)
+	}
+	return out
+}
+
+type hnswCandidate struct {
+	node int32
+	dist float32
+}
+
+type hnswMinHeap []hnswCandidate
+
+func (h hnswMinHeap) Len() int           { return len(h) }
+func (h hnswMinHeap) Less(i, j int) bool { return h[i].dist < h[j].dist }
+func (h hnswMinHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *hnswMinHeap) Push(x any)        { *h = append(*h, x.(hnswCandidate)) }
+func (h *hnswMinHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+type hnswMaxHeap []hnswCandidate
+
+func (h hnswMaxHeap) Len() int           { return len(h) }
+func (h hnswMaxHeap) Less(i, j int) bool { return h[i].dist > h[j].dist }
+func (h hnswMaxHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *hnswMaxHeap) Push(x any)        { *h = append(*h, x.(hnswCandidate)) }
+func (h *hnswMaxHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Types of metadata fields.
+const (
+	metaTypeString      = "string"
+	metaTypeInt         = "int"
+	metaTypeFloat       = "float"
+	metaTypeBool        = "bool"
+	metaTypeStringArray = "string_array"
+	metaTypeJSON        = "json"
+)
+
+var metaTypes = []string{metaTypeString, metaTypeInt, metaTypeFloat, metaTypeBool, metaTypeStringArray, metaTypeJSON}
+
+// Limits of the metadata fields declared at collection creation. Zero lengths
+// and capacities take the defaults.
+const (
+	maxSchemaFields          = 32
+	maxMetaLength            = 65535
+	maxMetaCapacity          = 4096
+	defaultMetaStringLength  = 256
+	defaultMetaElementLength = 64
+	defaultMetaArrayCapacity = 64
+)
+
+var metaFieldNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,254}$`)
+
+// metaDir is the folder, inside the image folder of a collection, that holds
+// the metadata captured at upload. Dot entries are never imported or served.
+const metaDir = ".meta"
+
+// MetaField is a scalar field stored with each image next to its vector.
+// MaxLength bounds strings and the elements of string arrays, MaxCapacity the
+// number of elements of string arrays. Images without a value for the field
+// get Default, or null when the field is Nullable, or else the zero value of
+// the type. PartitionKey makes Milvus place images by the value of the field.
+type MetaField struct {
+	Name         string      `json:"name"`
+	Type         string      `json:"type"`
+	MaxLength    int64       `json:"max_length,omitempty"`
+	MaxCapacity  int64       `json:"max_capacity,omitempty"`
+	Nullable     bool        `json:"nullable,omitempty"`
+	Default      interface{} `json:"default,omitempty"`
+	PartitionKey bool        `json:"partition_key,omitempty"`
+}
+
+// imageMetaFields are the metadata fields of every new collection.
+var imageMetaFields = []MetaField{
+	{Name: "tags", Type: metaTypeStringArray, MaxLength: 64, MaxCapacity: 64},
+	{Name: "album", Type: metaTypeString, MaxLength: 256},
+	{Name: "upload_time", Type: metaTypeInt},
+	{Name: "width", Type: metaTypeInt},
+	{Name: "height", Type: metaTypeInt},
+	{Name: "mime_type", Type: metaTypeString, MaxLength: 128},
+	{Name: "source", Type: metaTypeString, MaxLength: 512},
+	{Name: "extra", Type: metaTypeJSON},
+	{Name: uploadNameField, Type: metaTypeString, MaxLength: maxOriginalNameLength},
+}
+
+// metaValue converts value, as decoded from JSON, to the Go type of field:
+// string, int64, float64, bool, []string or map[string]interface{}. Missing
+// values take the default of the field, or stay nil if it is nullable.
+// Mistyped values become the zero value, and strings are cut to MaxLength.
+func (field MetaField) metaValue(value interface{}) interface{} {
+	if value == nil {
+		if field.Default != nil {
+			value = field.Default
+		} else if field.Nullable {
+			return nil
+		}
+	}
+	switch field.Type {
+	case metaTypeString:
+		s, _ := value.(string)
+		return truncate(s, field.MaxLength)
+	case metaTypeInt:
+		switch n := value.(type) {
+		case int64:
+			return n
+		case int:
+			return int64(n)
+		case float64:
+			return int64(n)
+		}
+		return int64(0)
+	case metaTypeFloat:
+		switch n := value.(type) {
+		case float64:
+			return n
+		case int64:
+			return float64(n)
+		case int:
+			return float64(n)
+		}
+		return float64(0)
+	case metaTypeBool:
+		b, _ := value.(bool)
+		return b
+	case metaTypeStringArray:
+		var list []string
+		switch v := value.(type) {
+		case []string:
+			list = v
+		case []interface{}:
+			for _, item := range v {
+				if s, ok := item.(string); ok {
+					list = append(list, s)
+				}
+			}
+		}
+		out := make([]string, 0, len(list))
+		for _, s := range list {
+			if field.MaxCapacity > 0 && int64(len(out)) == field.MaxCapacity {
+				break
+			}
+			out = append(out, truncate(s, field.MaxLength))
+		}
+		return out
+	case metaTypeJSON:
+		if m, ok := value.(map[string]interface{}); ok {
+			return m
+		}
+		return map[string]interface{}{}
+	}
+	return value
+}
+
+// partitionKeyField returns the partition key field among fields, if any.
+func partitionKeyField(fields []MetaField) (MetaField, bool) {
+	for _, field := range fields {
+		if field.PartitionKey {
+			return field, true
+		}
+	}
+	return MetaField{}, false
+}
+
+// storedValue is metaValue for stores that cannot hold nulls, which keep the
+// zero value of the type instead.
+func (field MetaField) storedValue(value interface{}) interface{} {
+	if v := field.metaValue(value); v != nil {
+		return v
+	}
+	return MetaField{Type: field.Type}.metaValue(nil)
+}
+
+// withLimits returns field with the default length and capacity filled in.
+func (field MetaField) withLimits() MetaField {
+	switch field.Type {
+	case metaTypeString:
+		field.MaxLength = int64(orDefault(int(field.MaxLength), defaultMetaStringLength))
+	case metaTypeStringArray:
+		field.MaxLength = int64(orDefault(int(field.MaxLength), defaultMetaElementLength))
+		field.MaxCapacity = int64(orDefault(int(field.MaxCapacity), defaultMetaArrayCapacity))
+	}
+	return field
+}
+
+// checkSchemaFields validates the metadata fields declared for a new
+// collection in addition to imageMetaFields. Errors name the fields as
+// param[i].key.
+func checkSchemaFields(param string, fields []MetaField) []fieldError {
+	var errs []fieldError
+	if len(fields) > maxSchemaFields {
+		errs = append(errs, fieldError{Field: param, Message: fmt.Sprintf("must have at most %d fields", maxSchemaFields)})
+	}
+	reserved := map[string]bool{"id": true, milvusVecField: true, milvusUrlField: true, milvusHashField: true}
+	for _, field := range imageMetaFields {
+		reserved[field.Name] = true
+	}
+	seen := map[string]bool{}
+	partitionKeys := 0
+	for i, field := range fields {
+		prefix := fmt.Sprintf("%s[%d].", param, i)
+		fail := func(key, message string) {
+			errs = append(errs, fieldError{Field: prefix + key, Message: message})
+		}
+		switch {
+		case field.Name == "":
+			fail("name", "is required")
+		case !metaFieldNamePattern.MatchString(field.Name):
+			fail("name", "must start with a letter or _ and use only letters, digits and _")
+		case reserved[field.Name]:
+			fail("name", "is a reserved field name")
+		case seen[field.Name]:
+			fail("name", "is declared twice")
+		}
+		seen[field.Name] = true
+
+		if !slices.Contains(metaTypes, field.Type) {
+			fail("type", "must be one of "+strings.Join(metaTypes, " "))
+			continue
+		}
+		hasLength := field.Type == metaTypeString || field.Type == metaTypeStringArray
+		switch {
+		case field.MaxLength != 0 && !hasLength:
+			fail("max_length", "is only supported by string and string_array")
+		case field.MaxLength < 0 || field.MaxLength > maxMetaLength:
+			fail("max_length", fmt.Sprintf("must be between 1 and %d", maxMetaLength))
+		}
+		switch {
+		case field.MaxCapacity != 0 && field.Type != metaTypeStringArray:
+			fail("max_capacity", "is only supported by string_array")
+		case field.MaxCapacity < 0 || field.MaxCapacity > maxMetaCapacity:
+			fail("max_capacity", fmt.Sprintf("must be between 1 and %d", maxMetaCapacity))
+		}
+		if field.Nullable && vectorStoreBackend == "milvus" {
+			// Milvus stores missing values as zero values, which a filter
+			// could not tell from real ones.
+			fail("nullable", "is not supported by the milvus vector store, use default instead")
+		}
+		if field.Default != nil && !field.withLimits().validValue(field.Default) {
+			fail("default", "must be a "+field.Type+" value within max_length and max_capacity")
+		}
+		if field.PartitionKey {
+			partitionKeys++
+			switch {
+			case field.Type != metaTypeString && field.Type != metaTypeInt:
+				fail("partition_key", "is only supported by string and int")
+			case field.Nullable:
+				fail("partition_key", "cannot be nullable")
+			case partitionKeys > 1:
+				fail("partition_key", "may be set on one field only")
+			}
+		}
+	}
+	return errs
+}
+
+// validValue reports whether value, as decoded from JSON, fits field without
+// conversion.
+func (field MetaField) validValue(value interface{}) bool {
+	switch field.Type {
+	case metaTypeString:
+		s, ok := value.(string)
+		return ok && int64(len(s)) <= field.MaxLength
+	case metaTypeInt:
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n) && math.Abs(n) <= 1<<53
+	case metaTypeFloat:
+		_, ok := value.(float64)
+		return ok
+	case metaTypeBool:
+		_, ok := value.(bool)
+		return ok
+	case metaTypeStringArray:
+		list, ok := value.([]interface{})
+		if !ok || int64(len(list)) > field.MaxCapacity {
+			return false
+		}
+		for _, item := range list {
+			if s, ok := item.(string); !ok || int64(len(s)) > field.MaxLength {
+				return false
+			}
+		}
+		return true
+	case metaTypeJSON:
+		_, ok := value.(map[string]interface{})
+		return ok
+	}
+	return false
+}
+
+// truncate cuts s to at most maxLength bytes without splitting a character.
+func truncate(s string, maxLength int64) string {
+	if maxLength <= 0 || int64(len(s)) <= maxLength {
+		return s
+	}
+	end := int(maxLength)
+	for end > 0 && !utf8.RuneStart(s[end]) {
+		end--
+	}
+	return s[:end]
+}
+
+// rowMeta returns the values of fields in meta, converted by metaValue.
+func rowMeta(fields []MetaField, meta map[string]interface{}) map[string]interface{} {
+	row := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		row[field.Name] = field.metaValue(meta[field.Name])
+	}
+	return row
+}
+
+// metaPath returns the sidecar file holding the upload metadata of the image
+// at path.
+func metaPath(path string) string {
+	return filepath.Join(filepath.Dir(path), metaDir, filepath.Base(path)+".json")
+}
+
+// writeImageMeta saves the upload metadata of the image at path.
+func writeImageMeta(path string, meta map[string]interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(metaPath(path)), os.ModePerm); err != nil {
+		return err
+	}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(metaPath(path), data, 0o644)
+}
+
+// readImageMeta returns the upload metadata of the image at path, or nil if
+// it has none.
+func readImageMeta(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(metaPath(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var meta map[string]interface{}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// collectImageMeta gathers the metadata of the image at path: the values
+// saved at upload, then defaults for those missing, then what the file itself
+// tells, i.e. its size, mime type and modification time.
+func collectImageMeta(path string, defaults map[string]interface{}) map[string]interface{} {
+	meta, err := readImageMeta(path)
+	if err != nil {
+		log.Println("failed to read image metadata, path="+path+", err: ", err.Error())
+	}
+	if meta == nil {
+		meta = map[string]interface{}{}
+	}
+	for key, value := range defaults {
+		if isEmptyMeta(meta[key]) {
+			meta[key] = value
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return meta
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, _ := f.Read(head)
+	meta["mime_type"] = http.DetectContentType(head[:n])
+	if _, err := f.Seek(0, 0); err == nil {
+		if cfg, _, err := image.DecodeConfig(f); err == nil {
+			meta["width"], meta["height"] = int64(cfg.Width), int64(cfg.Height)
+		}
+	}
+	if isEmptyMeta(meta["upload_time"]) {
+		if info, err := f.Stat(); err == nil {
+			meta["upload_time"] = info.ModTime().Unix()
+		}
+	}
+	return meta
+}
+
+func isEmptyMeta(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	case []string:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// uploadMeta is the metadata given with an upload: album, source, a comma
+// separated list of tags, a JSON object of extra fields and a JSON object of
+// values for the fields declared at collection creation.
+func uploadMeta(album, source, tags, extra, fields string) (map[string]interface{}, []fieldError) {
+	meta := map[string]interface{}{}
+	if fields != "" {
+		if err := json.Unmarshal([]byte(fields), &meta); err != nil || meta == nil {
+			return nil, []fieldError{{Field: "meta", Message: "must be a JSON object"}}
+		}
+	}
+	meta["upload_time"] = time.Now().Unix()
+	if album != "" {
+		meta["album"] = album
+	}
+	if source != "" {
+		meta["source"] = source
+	}
+	if list := splitTags(tags); len(list) > 0 {
+		meta["tags"] = list
+	}
+	if extra != "" {
+		var values map[string]interface{}
+		if err := json.Unmarshal([]byte(extra), &values); err != nil || values == nil {
+			return nil, []fieldError{{Field: "extra", Message: "must be a JSON object"}}
+		}
+		meta["extra"] = values
+	}
+	return meta, nil
+}
+
+func splitTags(tags string) []string {
+	var list []string
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			list = append(list, tag)
+		}
+	}
+	return list
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCheckSchemaFields(t *testing.T) {
+	prev := vectorStoreBackend
+	t.Cleanup(func() { vectorStoreBackend = prev })
+
+	tests := []struct {
+		name    string
+		backend string
+		fields  []MetaField
+		// errs are the fields of the expected errors.
+		errs []string
+	}{
+		{"valid", "milvus", []MetaField{
+			{Name: "camera", Type: metaTypeString, MaxLength: 64, Default: "unknown"},
+			{Name: "owner_id", Type: metaTypeInt, PartitionKey: true},
+		}, nil},
+		{"nullable on milvus", "milvus", []MetaField{{Name: "rating", Type: metaTypeFloat, Nullable: true}}, []string{"schema_fields[0].nullable"}},
+		{"nullable on local", "local", []MetaField{{Name: "rating", Type: metaTypeFloat, Nullable: true}}, nil},
+		{"reserved", "local", []MetaField{{Name: "url", Type: metaTypeString}, {Name: "album", Type: metaTypeString}}, []string{"schema_fields[0].name", "schema_fields[1].name"}},
+		{"twice", "local", []MetaField{{Name: "a", Type: metaTypeInt}, {Name: "a", Type: metaTypeInt}}, []string{"schema_fields[1].name"}},
+		{"bad type", "local", []MetaField{{Name: "a", Type: "date"}}, []string{"schema_fields[0].type"}},
+		{"bad default", "local", []MetaField{{Name: "a", Type: metaTypeInt, Default: "x"}}, []string{"schema_fields[0].default"}},
+		{"nullable partition key", "local", []MetaField{{Name: "a", Type: metaTypeInt, Nullable: true, PartitionKey: true}}, []string{"schema_fields[0].partition_key"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vectorStoreBackend = tt.backend
+			errs := checkSchemaFields("schema_fields", tt.fields)
+			if len(errs) != len(tt.errs) {
+				t.Fatalf("got %v, want errors on %v", errs, tt.errs)
+			}
+			for i, err := range errs {
+				if err.Field != tt.errs[i] {
+					t.Errorf("error %d: got %s, want %s", i, err.Field, tt.errs[i])
+				}
+			}
+		})
+	}
+}
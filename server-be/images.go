@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// imagePath returns the file of the image stored with url in collection, and
+// false when url is not inside the image folder of the collection. Rows only
+// ever point into that folder, but files elsewhere must never be touched.
+func imagePath(collection string, url string) (string, bool) {
+	dir := filepath.Clean(uploadServerPath + "/" + collection)
+	path := filepath.Clean(url)
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return path, true
+}
+
+// deleteImages deletes rows from collection, then the image files and upload
+// metadata that no other row uses, and returns the removed files.
+func deleteImages(ctx context.Context, store VectorStore, collection string, rows []IndexedFile) ([]string, error) {
+	ids := make([]int64, 0, len(rows))
+	deleted := make(map[int64]bool, len(rows))
+	urls := make([]string, 0, len(rows))
+	seen := map[string]bool{}
+	for _, row := range rows {
+		ids = append(ids, row.ID)
+		deleted[row.ID] = true
+		if !seen[row.Url] {
+			seen[row.Url] = true
+			urls = append(urls, row.Url)
+		}
+	}
+	// The same file may be imported into several partitions; it stays as
+	// long as one of its rows does.
+	all, err := store.FindFiles(ctx, collection, filterIn("url", urls))
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range all {
+		if !deleted[row.ID] {
+			seen[row.Url] = false
+		}
+	}
+	if err := store.Delete(ctx, collection, ids); err != nil {
+		return nil, err
+	}
+
+	removed := []string{}
+	for _, url := range urls {
+		path, ok := imagePath(collection, url)
+		if !seen[url] || !ok {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Println("failed to remove image, path="+path+", err: ", err.Error())
+			continue
+		}
+		if err := os.Remove(metaPath(path)); err != nil && !os.IsNotExist(err) {
+			log.Println("failed to remove image metadata, path="+path+", err: ", err.Error())
+		}
+		removed = append(removed, url)
+	}
+	return removed, nil
+}
+
+// ImageResponse is one image of a GET /api/collections/:name/images response.
+// Filename is the name the image was uploaded with, when it is known.
+type ImageResponse struct {
+	ID       int64                  `json:"id"`
+	Url      string                 `json:"url"`
+	Filename string                 `json:"filename"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// imageList pages through the images stored in a collection, without a
+// search.
+func imageList(gincontext *gin.Context) {
+	var req ImageListRequest
+	if !bindRouteParams(gincontext, &req, map[string]string{"collection_name": gincontext.Param("name")}) {
+		return
+	}
+	ctx := context.Background()
+	store, err := newVectorStore(ctx, req.storeConfig())
+	if err != nil {
+		log.Println("failed to connect to milvus, err: ", err.Error())
+		respondError(gincontext, codeMilvusUnavailable, "failed to connect to milvus: "+err.Error(), nil)
+		return
+	}
+	defer store.Close()
+
+	page, err := store.QueryImages(ctx, req.CollectionName, ImageQuery{Filter: req.Filter, Offset: int(req.Offset), Limit: req.limit()})
+	if err != nil {
+		respondStoreError(gincontext, "failed to list images", err)
+		return
+	}
+	data := make([]ImageResponse, 0, len(page.Images))
+	for _, image := range page.Images {
+		data = append(data, ImageResponse{ID: image.ID, Url: image.Url, Filename: displayName(image.Url, image.Metadata), Metadata: image.Metadata})
+	}
+	gincontext.JSON(http.StatusOK, gin.H{"message": "success", "total": page.Total, "offset": int(req.Offset), "limit": req.limit(), "data": data})
+}
+
+func imageDelete(gincontext *gin.Context) {
+	var req ImageDeleteRequest
+	if !bindRouteParams(gincontext, &req, map[string]string{"collection_name": gincontext.Param("name"), "id": gincontext.Param("id")}) {
+		return
+	}
+	ctx := context.Background()
+	store, err := newVectorStore(ctx, req.storeConfig())
+	if err != nil {
+		log.Println("failed to connect to milvus, err: ", err.Error())
+		respondError(gincontext, codeMilvusUnavailable, "failed to connect to milvus: "+err.Error(), nil)
+		return
+	}
+	defer store.Close()
+
+	rows, err := store.FindFiles(ctx, req.CollectionName, "id == "+strconv.Itoa(int(req.ID)))
+	if err != nil {
+		respondStoreError(gincontext, "failed to find image", err)
+		return
+	}
+	if len(rows) == 0 {
+		respondError(gincontext, codeImageNotFound, fmt.Sprintf("no image %d in collection %s", req.ID, req.CollectionName), nil)
+		return
+	}
+	removed, err := deleteImages(ctx, store, req.CollectionName, rows)
+	if err != nil {
+		respondStoreError(gincontext, "failed to delete image", err)
+		return
+	}
+	log.Printf(msgFmt, fmt.Sprintf("image deleted, `%s` id %d", req.CollectionName, req.ID))
+	gincontext.JSON(http.StatusOK, gin.H{"message": "success", "deleted": len(rows), "removed_files": removed})
+}
+
+func imagesDelete(gincontext *gin.Context) {
+	var req ImagesDeleteRequest
+	if !bindRouteParams(gincontext, &req, map[string]string{"collection_name": gincontext.Param("name")}) {
+		return
+	}
+	ctx := context.Background()
+	store, err := newVectorStore(ctx, req.storeConfig())
+	if err != nil {
+		log.Println("failed to connect to milvus, err: ", err.Error())
+		respondError(gincontext, codeMilvusUnavailable, "failed to connect to milvus: "+err.Error(), nil)
+		return
+	}
+	defer store.Close()
+
+	if len(req.Hashes) > 0 {
+		stats, err := store.Stats(ctx, req.CollectionName)
+		if err != nil {
+			respondStoreError(gincontext, "failed to describe collection", err)
+			return
+		}
+		if !stats.HasHash {
+			respondError(gincontext, codeInvalidParams, "collection "+req.CollectionName+" has no hash field", []fieldError{{Field: "hashes", Message: "is not supported by the collection"}})
+			return
+		}
+	}
+	rows, err := store.FindFiles(ctx, req.CollectionName, req.filter())
+	if err != nil {
+		respondStoreError(gincontext, "failed to find images", err)
+		return
+	}
+	removed := []string{}
+	if len(rows) > 0 {
+		if removed, err = deleteImages(ctx, store, req.CollectionName, rows); err != nil {
+			respondStoreError(gincontext, "failed to delete images", err)
+			return
+		}
+	}
+	log.Printf(msgFmt, fmt.Sprintf("images deleted, `%s` %d rows", req.CollectionName, len(rows)))
+	gincontext.JSON(http.StatusOK, gin.H{"message": "success", "deleted": len(rows), "removed_files": removed})
+}
+
+// imageReplace stores the uploaded file in place of an image and replaces its
+// rows, in every partition holding it, with the new embedding. The old file
+// is only removed once the new rows are in.
+func imageReplace(gincontext *gin.Context) {
+	var req ImageReplaceRequest
+	if !bindFormParams(gincontext, &req, map[string]string{"collection_name": gincontext.Param("name"), "id": gincontext.Param("id")}) {
+		return
+	}
+	file, err := gincontext.FormFile("file")
+	if err != nil {
+		respondError(gincontext, codeInvalidParams, "file is required", []fieldError{{Field: "file", Message: "is required"}})
+		return
+	}
+	var meta map[string]interface{}
+	if req.Album != "" || req.Tags != "" || req.Source != "" || req.Extra != "" || req.Meta != "" {
+		var errs []fieldError
+		if meta, errs = uploadMeta(req.Album, req.Source, req.Tags, req.Extra, req.Meta); len(errs) > 0 {
+			respondError(gincontext, codeInvalidParams, "invalid upload metadata", errs)
+			return
+		}
+		name, err := originalName(uploadFilename(file))
+		if err != nil {
+			respondError(gincontext, codeInvalidParams, "invalid file name: "+uploadFilename(file), []fieldError{{Field: "file", Message: "must be a plain file name"}})
+			return
+		}
+		meta[uploadNameField] = name
+	}
+	embedder, err := req.embedder()
+	if err != nil {
+		log.Println("failed to create embedder, err: ", err.Error())
+		respondError(gincontext, codeInvalidParams, "failed to create embedder: "+err.Error(), nil)
+		return
+	}
+
+	ctx := context.Background()
+	store, err := newVectorStore(ctx, req.storeConfig())
+	if err != nil {
+		log.Println("failed to connect to milvus, err: ", err.Error())
+		respondError(gincontext, codeMilvusUnavailable, "failed to connect to milvus: "+err.Error(), nil)
+		return
+	}
+	defer store.Close()
+
+	stats, err := store.Stats(ctx, req.CollectionName)
+	if err != nil {
+		respondStoreError(gincontext, "failed to describe collection", err)
+		return
+	}
+	rows, err := store.FindFiles(ctx, req.CollectionName, "id == "+strconv.Itoa(int(req.ID)))
+	if err != nil {
+		respondStoreError(gincontext, "failed to find image", err)
+		return
+	}
+	if len(rows) == 0 {
+		respondError(gincontext, codeImageNotFound, fmt.Sprintf("no image %d in collection %s", req.ID, req.CollectionName), nil)
+		return
+	}
+	url := rows[0].Url
+	path, ok := imagePath(req.CollectionName, url)
+	if !ok {
+		respondError(gincontext, codeInvalidParams, "image "+url+" is not stored in the collection folder", nil)
+		return
+	}
+	rows, err = store.FindFiles(ctx, req.CollectionName, filterIn("url", []string{url}))
+	if err != nil {
+		respondStoreError(gincontext, "failed to find image", err)
+		return
+	}
+
+	// The new file is kept under a hidden name, which imports skip, until its
+	// rows are in place; any failure before that leaves the old image as it
+	// was.
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".replace")
+	if err := gincontext.SaveUploadedFile(file, tmp); err != nil {
+		respondError(gincontext, codeUploadFailed, "failed to save image: "+err.Error(), nil)
+		return
+	}
+	defer os.Remove(tmp)
+	defer os.Remove(metaPath(tmp))
+	vec, err := embedder.EmbedImage(ctx, tmp)
+	if err == nil {
+		err = checkEmbeddingDim(vec, stats.Dim)
+	}
+	if err != nil {
+		log.Println("get vector error, path="+path+", err: ", err.Error())
+		respondError(gincontext, codeEmbedderFailed, "failed to embed image: "+err.Error(), nil)
+		return
+	}
+	// The upload metadata replaces that of the old image, if any was sent.
+	if meta == nil {
+		if meta, err = readImageMeta(path); err != nil {
+			log.Println("failed to read image metadata, path="+path+", err: ", err.Error())
+		}
+	}
+	if meta != nil {
+		if err := writeImageMeta(tmp, meta); err != nil {
+			respondError(gincontext, codeUploadFailed, "failed to save image metadata: "+err.Error(), nil)
+			return
+		}
+	}
+
+	// The replacement gets a stored name of its own, so that a change of
+	// type shows in its extension.
+	name, err := newStoredName(uploadFilename(file))
+	if err != nil {
+		respondError(gincontext, codeUploadFailed, "failed to save image: "+err.Error(), nil)
+		return
+	}
+	dst := filepath.Join(filepath.Dir(path), name)
+	newUrl := filepath.ToSlash(filepath.Join(filepath.Dir(url), name))
+	row := VectorRow{Vec: vec, Url: newUrl}
+	if stats.HasHash {
+		if row.Hash, err = hashFile(tmp); err != nil {
+			respondError(gincontext, codeUploadFailed, "failed to hash image: "+err.Error(), nil)
+			return
+		}
+	}
+	if len(stats.MetaFields) > 0 {
+		row.Meta = collectImageMeta(tmp, nil)
+	}
+	partitions := map[string]bool{}
+	for _, old := range rows {
+		if !partitions[old.Partition] {
+			partitions[old.Partition] = true
+			if err := store.Insert(ctx, req.CollectionName, old.Partition, []VectorRow{row}); err != nil {
+				removeRows(ctx, store, req.CollectionName, newUrl)
+				respondStoreError(gincontext, "failed to insert image", err)
+				return
+			}
+		}
+	}
+	if _, err := deleteImages(ctx, store, req.CollectionName, rows); err != nil {
+		removeRows(ctx, store, req.CollectionName, newUrl)
+		respondStoreError(gincontext, "failed to delete old image", err)
+		return
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		respondError(gincontext, codeUploadFailed, "failed to save image: "+err.Error(), nil)
+		return
+	}
+	if meta != nil {
+		if err := os.Rename(metaPath(tmp), metaPath(dst)); err != nil {
+			log.Println("failed to save image metadata, path="+dst+", err: ", err.Error())
+		}
+	}
+	log.Printf(msgFmt, fmt.Sprintf("image replaced, `%s` %s by %s", req.CollectionName, url, newUrl))
+	gincontext.JSON(http.StatusOK, gin.H{"message": "success", "url": newUrl, "replaced": len(rows)})
+}
+
+// removeRows deletes the rows of collection stored with url, undoing a
+// replacement that failed halfway. Errors are only logged, since the failure
+// that caused the undo is what gets reported.
+func removeRows(ctx context.Context, store VectorStore, collection string, url string) {
+	rows, err := store.FindFiles(ctx, collection, filterIn("url", []string{url}))
+	if err == nil && len(rows) > 0 {
+		ids := make([]int64, 0, len(rows))
+		for _, row := range rows {
+			ids = append(ids, row.ID)
+		}
+		err = store.Delete(ctx, collection, ids)
+	}
+	if err != nil {
+		log.Println("failed to remove rows of "+url+", err: ", err.Error())
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// replaceImage sends the file name with content as the new image id of
+// collection.
+func (ts *testServer) replaceImage(collection string, id int64, name string, content string) (int, map[string]interface{}) {
+	ts.t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for key, value := range ts.params(collection) {
+		form.WriteField(key, fmt.Sprint(value))
+	}
+	part, err := form.CreateFormFile("file", name)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	part.Write([]byte(content))
+	form.Close()
+	req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/api/collections/%s/images/%d", collection, id), &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return ts.serve(req)
+}
+
+// importedCat uploads and imports a single image and returns its row.
+func (ts *testServer) importedCat(collection string) IndexedFile {
+	ts.t.Helper()
+	ts.createCollection(collection, "FLAT")
+	if code, resp := ts.upload(collection, testUpload{"cat.png", "a cat"}); code != http.StatusOK {
+		ts.t.Fatalf("upload: %d %v", code, resp)
+	}
+	ts.importImages(collection)
+	rows, err := ts.store.ListFiles(context.Background(), collection, "")
+	if err != nil || len(rows) != 1 {
+		ts.t.Fatalf("rows after import: %v %v", rows, err)
+	}
+	return rows[0]
+}
+
+func TestImageReplace(t *testing.T) {
+	ts := newTestServer(t)
+	old := ts.importedCat("pets")
+
+	code, resp := ts.replaceImage("pets", old.ID, "dog.jpg", "a dog")
+	if code != http.StatusOK {
+		t.Fatalf("replace: %d %v", code, resp)
+	}
+	url := resp["url"].(string)
+	if url == old.Url || filepath.Ext(url) != ".jpg" || filepath.Dir(url) != filepath.Dir(old.Url) {
+		t.Errorf("new url: got %s, replacing %s", url, old.Url)
+	}
+	if data, err := os.ReadFile(url); err != nil || string(data) != "a dog" {
+		t.Errorf("new image: got %q, %v", data, err)
+	}
+	if _, err := os.Stat(old.Url); !os.IsNotExist(err) {
+		t.Errorf("old image left: %v", err)
+	}
+	rows, _ := ts.store.ListFiles(context.Background(), "pets", "")
+	if len(rows) != 1 || rows[0].Url != url {
+		t.Fatalf("rows after replace: %v", rows)
+	}
+	if hits := ts.search("pets", "a dog", nil); len(hits) != 1 || hits[0] != url {
+		t.Errorf("search for the dog: got %v", hits)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(url))
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".replace") {
+			t.Errorf("temporary file left: %s", entry.Name())
+		}
+	}
+}
+
+// failingStore fails its first Delete.
+type failingStore struct {
+	VectorStore
+	failed bool
+}
+
+func (s *failingStore) Delete(ctx context.Context, collection string, ids []int64) error {
+	if !s.failed {
+		s.failed = true
+		return errors.New("delete failed")
+	}
+	return s.VectorStore.Delete(ctx, collection, ids)
+}
+
+func TestImageReplaceFailure(t *testing.T) {
+	ts := newTestServer(t)
+	old := ts.importedCat("pets")
+	newVectorStore = func(ctx context.Context, cfg StoreConfig) (VectorStore, error) {
+		return &failingStore{VectorStore: ts.store}, nil
+	}
+
+	if code, resp := ts.replaceImage("pets", old.ID, "dog.jpg", "a dog"); code == http.StatusOK {
+		t.Fatalf("replace with a failing delete: %d %v", code, resp)
+	}
+	// The old image and its row are kept, and the new row is gone.
+	if data, err := os.ReadFile(old.Url); err != nil || string(data) != "a cat" {
+		t.Errorf("old image: got %q, %v", data, err)
+	}
+	rows, _ := ts.store.ListFiles(context.Background(), "pets", "")
+	if len(rows) != 1 || rows[0].ID != old.ID {
+		t.Errorf("rows after a failed replace: %v", rows)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(old.Url))
+	if len(entries) != 2 {
+		t.Errorf("files after a failed replace: got %d entries, want the image and .meta", len(entries))
+	}
+}
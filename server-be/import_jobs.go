@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+	jobCanceled  = "canceled"
+
+	// jobRetention is how long finished jobs stay queryable.
+	jobRetention = time.Hour
+
+	// jobEventTotal tells subscribers how many files the import will process.
+	jobEventTotal = "total"
+	// jobEventBuffer is the number of events a subscriber may fall behind by
+	// before further events are dropped for it.
+	jobEventBuffer = 256
+)
+
+// importJob is an import running in the background. Its counters are
+// updated from the import pipeline and read by the jobs API.
+type importJob struct {
+	mu         sync.Mutex
+	id         string
+	collection string
+	partition  string
+	status     string
+	total      int
+	processed  int
+	failed     int
+	skipped    int
+	inserted   int
+	deleted    int
+	current    string
+	err        string
+	startedAt  time.Time
+	finishedAt time.Time
+	cancel     context.CancelFunc
+	// subscribers receive the pipeline events of the job. Their channels are
+	// closed when the job finishes.
+	subscribers map[chan importEvent]struct{}
+}
+
+// ImportJobInfo is the JSON view of an importJob.
+type ImportJobInfo struct {
+	ID          string     `json:"id"`
+	Collection  string     `json:"collection"`
+	Partition   string     `json:"partition"`
+	Status      string     `json:"status"`
+	Total       int        `json:"total"`
+	Processed   int        `json:"processed"`
+	Failed      int        `json:"failed"`
+	Skipped     int        `json:"skipped"`
+	Inserted    int        `json:"inserted"`
+	Deleted     int        `json:"deleted"`
+	CurrentFile string     `json:"current_file"`
+	Error       string     `json:"error,omitempty"`
+	StartedAt   time.Time  `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	// EtaSeconds estimates the remaining time from the average rate so far.
+	EtaSeconds *float64 `json:"eta_seconds,omitempty"`
+}
+
+// jobManager keeps the import jobs of this process.
+type jobManager struct {
+	mu   sync.Mutex
+	jobs map[string]*importJob
+	// running holds the running job of each import target, see importKey.
+	running map[string]*importJob
+}
+
+var importJobs = &jobManager{jobs: map[string]*importJob{}, running: map[string]*importJob{}}
+
+// importKey names the target of an import: a partition of a collection in
+// one store. Two imports into the same target would both see the same files
+// as new and insert them twice, so only one may run at a time.
+func importKey(cfg StoreConfig, collection string, partition string) string {
+	if partition == "" {
+		partition = defaultPartition
+	}
+	return fmt.Sprintf("%s:%s/%s/%s", cfg.MilvusServer, cfg.MilvusPort, collection, partition)
+}
+
+func newJobID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
+
+// start registers a job importing into partition of collection and runs fn
+// in the background with a context that is canceled by the cancel endpoint.
+// If a job for the same key is still running, nothing is started and that
+// job is returned with false.
+func (m *jobManager) start(key string, collection string, partition string, fn func(ctx context.Context, job *importJob) error) (*importJob, bool) {
+	m.mu.Lock()
+	if running, ok := m.running[key]; ok {
+		m.mu.Unlock()
+		return running, false
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &importJob{
+		id:         newJobID(),
+		collection: collection,
+		partition:  partition,
+		status:     jobRunning,
+		startedAt:  time.Now(),
+		cancel:     cancel,
+	}
+	for id, old := range m.jobs {
+		if info := old.info(); info.FinishedAt != nil && time.Since(*info.FinishedAt) > jobRetention {
+			delete(m.jobs, id)
+		}
+	}
+	m.jobs[job.id] = job
+	m.running[key] = job
+	m.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		err := fn(ctx, job)
+		m.mu.Lock()
+		delete(m.running, key)
+		m.mu.Unlock()
+		job.finish(err, ctx.Err() != nil)
+	}()
+	return job, true
+}
+
+func (m *jobManager) get(id string) (*importJob, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	return job, ok
+}
+
+func (j *importJob) setTotal(total int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.total = total
+	j.publish(importEvent{Type: jobEventTotal, Count: total})
+}
+
+// subscribe returns a channel of the events of the job from now on, which is
+// closed when the job finishes, and a func to stop receiving them. The
+// channel is nil if the job has already finished.
+func (j *importJob) subscribe() (<-chan importEvent, func()) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.status != jobRunning {
+		return nil, func() {}
+	}
+	ch := make(chan importEvent, jobEventBuffer)
+	if j.subscribers == nil {
+		j.subscribers = map[chan importEvent]struct{}{}
+	}
+	j.subscribers[ch] = struct{}{}
+	return ch, func() {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		if _, ok := j.subscribers[ch]; ok {
+			delete(j.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// publish sends event to every subscriber without blocking the import: a
+// subscriber whose buffer is full misses the event. j.mu must be held.
+func (j *importJob) publish(event importEvent) {
+	for ch := range j.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// observe updates the job from a pipeline event.
+func (j *importJob) observe(event importEvent) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	switch event.Type {
+	case importEventEmbedded:
+		j.processed++
+		j.current = event.Path
+	case importEventFailed:
+		j.processed++
+		j.failed++
+		j.current = event.Path
+	case importEventSkipped:
+		j.processed++
+		j.skipped++
+	case importEventInserted:
+		j.inserted += event.Count
+	case importEventDeleted:
+		j.deleted += event.Count
+	}
+	j.publish(event)
+}
+
+func (j *importJob) finish(err error, canceled bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.finishedAt = time.Now()
+	j.current = ""
+	switch {
+	case canceled:
+		j.status = jobCanceled
+	case err != nil:
+		j.status = jobFailed
+		j.err = err.Error()
+	default:
+		j.status = jobSucceeded
+	}
+	for ch := range j.subscribers {
+		close(ch)
+	}
+	j.subscribers = nil
+}
+
+func (j *importJob) info() ImportJobInfo {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	info := ImportJobInfo{
+		ID:          j.id,
+		Collection:  j.collection,
+		Partition:   j.partition,
+		Status:      j.status,
+		Total:       j.total,
+		Processed:   j.processed,
+		Failed:      j.failed,
+		Skipped:     j.skipped,
+		Inserted:    j.inserted,
+		Deleted:     j.deleted,
+		CurrentFile: j.current,
+		Error:       j.err,
+		StartedAt:   j.startedAt,
+	}
+	if j.status != jobRunning {
+		finishedAt := j.finishedAt
+		info.FinishedAt = &finishedAt
+	} else if j.processed > 0 && j.total >= j.processed {
+		perFile := time.Since(j.startedAt).Seconds() / float64(j.processed)
+		eta := perFile * float64(j.total-j.processed)
+		info.EtaSeconds = &eta
+	}
+	return info
+}
+
+// countFiles counts the files under root, which is the total of an import.
+func countFiles(root string) (int, error) {
+	count := 0
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, errWalk error) error {
+		if errWalk != nil {
+			return errWalk
+		}
+		if hiddenEntry(root, path, d) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+func jobStatus(gincontext *gin.Context) {
+	job, ok := importJobs.get(gincontext.Param("id"))
+	if !ok {
+		respondError(gincontext, codeJobNotFound, "job not found: "+gincontext.Param("id"), nil)
+		return
+	}
+	gincontext.JSON(http.StatusOK, job.info())
+}
+
+// jobEvents streams the progress of a job as Server-Sent Events: a progress
+// event with the current state, then every total, embedded, failed, skipped,
+// inserted and deleted event of the pipeline, and a done event with the final
+// state.
+func jobEvents(gincontext *gin.Context) {
+	job, ok := importJobs.get(gincontext.Param("id"))
+	if !ok {
+		respondError(gincontext, codeJobNotFound, "job not found: "+gincontext.Param("id"), nil)
+		return
+	}
+	events, unsubscribe := job.subscribe()
+	defer unsubscribe()
+
+	gincontext.Header("Cache-Control", "no-cache")
+	gincontext.Header("X-Accel-Buffering", "no")
+	gincontext.SSEvent("progress", job.info())
+	if events == nil {
+		gincontext.SSEvent("done", job.info())
+		return
+	}
+	keepalive := time.NewTicker(15 * time.Second)
+	defer keepalive.Stop()
+	gincontext.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				gincontext.SSEvent("done", job.info())
+				return false
+			}
+			gincontext.SSEvent(event.Type, event)
+			return true
+		case <-keepalive.C:
+			gincontext.SSEvent("ping", "")
+			return true
+		case <-gincontext.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+func jobCancel(gincontext *gin.Context) {
+	job, ok := importJobs.get(gincontext.Param("id"))
+	if !ok {
+		respondError(gincontext, codeJobNotFound, "job not found: "+gincontext.Param("id"), nil)
+		return
+	}
+	log.Printf(msgFmt, "cancel import job "+job.id)
+	job.cancel()
+	gincontext.JSON(http.StatusOK, job.info())
+}
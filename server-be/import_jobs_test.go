@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// waitJob waits until job has finished.
+func waitJob(t *testing.T, job *importJob) ImportJobInfo {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if info := job.info(); info.Status != jobRunning {
+			return info
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", job.id)
+	return ImportJobInfo{}
+}
+
+func TestImportJobLock(t *testing.T) {
+	m := &jobManager{jobs: map[string]*importJob{}, running: map[string]*importJob{}}
+	cfg := StoreConfig{MilvusServer: "localhost", MilvusPort: "19530"}
+	release := make(chan struct{})
+	blocking := func(ctx context.Context, job *importJob) error {
+		<-release
+		return nil
+	}
+	done := func(ctx context.Context, job *importJob) error { return nil }
+
+	first, ok := m.start(importKey(cfg, "pets", ""), "pets", "", blocking)
+	if !ok {
+		t.Fatal("first import not started")
+	}
+	// The default partition is the same target whether named or not.
+	if job, ok := m.start(importKey(cfg, "pets", defaultPartition), "pets", defaultPartition, done); ok || job != first {
+		t.Fatalf("second import into the same partition: started %v, job %s, want job %s", ok, job.id, first.id)
+	}
+	other, ok := m.start(importKey(cfg, "pets", "cats"), "pets", "cats", done)
+	if !ok {
+		t.Fatal("import into another partition not started")
+	}
+	waitJob(t, other)
+
+	close(release)
+	if info := waitJob(t, first); info.Status != jobSucceeded {
+		t.Fatalf("first import: %s", info.Status)
+	}
+	again, ok := m.start(importKey(cfg, "pets", ""), "pets", "", done)
+	if !ok || again == first {
+		t.Fatal("import not started after the previous one finished")
+	}
+	waitJob(t, again)
+}
+
+func TestJobEvents(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := httptest.NewServer(newRouter())
+	defer server.Close()
+
+	// The job sends its events once the client has subscribed.
+	job, _ := importJobs.start("test/events", "pets", "", func(ctx context.Context, job *importJob) error {
+		for {
+			job.mu.Lock()
+			subscribed := len(job.subscribers) > 0
+			job.mu.Unlock()
+			if subscribed {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		job.setTotal(2)
+		job.observe(importEvent{Type: importEventEmbedded, Path: "uploads/pets/cat.png"})
+		job.observe(importEvent{Type: importEventFailed, Path: "uploads/pets/dog.png", Error: "bad image"})
+		job.observe(importEvent{Type: importEventInserted, Count: 1})
+		return nil
+	})
+	resp, err := http.Get(server.URL + "/api/jobs/" + job.id + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var events []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if name, ok := strings.CutPrefix(scanner.Text(), "event:"); ok {
+			events = append(events, name)
+		}
+	}
+	want := []string{"progress", jobEventTotal, importEventEmbedded, importEventFailed, importEventInserted, "done"}
+	if strings.Join(events, " ") != strings.Join(want, " ") {
+		t.Errorf("events: got %v, want %v", events, want)
+	}
+
+	resp, err = http.Get(server.URL + "/api/jobs/nope/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("events of an unknown job: got %d, want 404", resp.StatusCode)
+	}
+}
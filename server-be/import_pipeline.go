@@ -0,0 +1,375 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// defaultImportWorkers is the number of concurrent embedding requests
+	// during import, unless the request sets import_workers.
+	defaultImportWorkers = 4
+	// defaultInsertBatchSize is the number of rows per insert during import,
+	// unless the request sets insert_batch_size.
+	defaultInsertBatchSize = 256
+)
+
+// importOptions configures one run of runImport.
+type importOptions struct {
+	// EmbedBatchSize is the number of images per embedding request.
+	EmbedBatchSize int
+	// Workers is the number of embedding requests in flight.
+	Workers int
+	// InsertBatchSize is the number of rows per VectorStore.Insert.
+	InsertBatchSize int
+	// Partition is the partition rows are inserted into; empty means the
+	// default one.
+	Partition string
+	// Dim is the collection dim every embedding is checked against.
+	Dim int64
+	// Indexed are the rows already in the collection. A file whose url is
+	// indexed is skipped when its hash is unchanged, or when the collection
+	// keeps no hashes, and replaced otherwise.
+	Indexed []IndexedFile
+	// HashFiles stores the SHA-256 of each file with its row.
+	HashFiles bool
+	// Prune deletes the rows of indexed files that are no longer under root.
+	Prune bool
+	// MetaFields are the metadata fields of the collection. Metadata is only
+	// collected when there are any.
+	MetaFields []MetaField
+	// Meta is the metadata of the files that were not given any at upload.
+	Meta map[string]interface{}
+	// OnEvent, if set, is called for every importEvent. It may be called
+	// from several goroutines at once.
+	OnEvent func(importEvent)
+}
+
+const (
+	importEventEmbedded = "embedded"
+	importEventFailed   = "failed"
+	importEventInserted = "inserted"
+	importEventSkipped  = "skipped"
+	importEventDeleted  = "deleted"
+)
+
+// importEvent reports the progress of runImport: a file was embedded, could
+// not be embedded or was skipped as already indexed, or a batch of rows was
+// inserted or deleted.
+type importEvent struct {
+	Type  string `json:"type"`
+	Path  string `json:"path,omitempty"`
+	Count int    `json:"count,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// importResult counts the work done by runImport, also when it fails.
+type importResult struct {
+	Embedded int
+	Failed   int
+	Skipped  int
+	Inserted int
+	Deleted  int
+}
+
+// importFile is a file waiting to be embedded.
+type importFile struct {
+	Path string
+	Hash string
+	Meta map[string]interface{}
+}
+
+// runImport embeds every file under root and inserts the vectors into
+// collection. It runs as a pipeline: one goroutine walks root and groups
+// paths into embedding batches, opts.Workers goroutines embed them, and the
+// caller's goroutine inserts rows in batches of opts.InsertBatchSize. The
+// channels between the stages are bounded, so a slow embedder or store holds
+// the walk back and memory stays flat however large root is.
+//
+// A file that cannot be embedded is counted as failed and skipped. Walk and
+// insert errors stop the pipeline; rows inserted before them are kept.
+//
+// Files already in opts.Indexed with the same hash are not embedded again.
+// The old rows of a changed file are deleted once its new row is inserted,
+// and with opts.Prune the rows of files missing under root are deleted after
+// a complete walk.
+func runImport(ctx context.Context, store VectorStore, embedder Embedder, collection string, root string, opts importOptions) (importResult, error) {
+	var result importResult
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var embeddedCount, failedCount, skippedCount atomic.Int64
+	emit := func(event importEvent) {
+		switch event.Type {
+		case importEventEmbedded:
+			embeddedCount.Add(1)
+		case importEventFailed:
+			failedCount.Add(1)
+		case importEventSkipped:
+			skippedCount.Add(1)
+		}
+		if opts.OnEvent != nil {
+			opts.OnEvent(event)
+		}
+	}
+
+	var errOnce sync.Once
+	var firstErr error
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	indexed := make(map[string][]IndexedFile)
+	for _, file := range opts.Indexed {
+		indexed[file.Url] = append(indexed[file.Url], file)
+	}
+
+	// seen, duplicates and walked belong to the walker until batches is
+	// closed, which happens before the insert loop below ends.
+	seen := make(map[string]bool)
+	var duplicates []int64
+	walked := false
+	batches := make(chan []importFile, opts.Workers)
+	go func() {
+		defer close(batches)
+		batch := make([]importFile, 0, opts.EmbedBatchSize)
+		send := func() bool {
+			select {
+			case batches <- batch:
+				batch = make([]importFile, 0, opts.EmbedBatchSize)
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, errWalk error) error {
+			if errWalk != nil {
+				log.Printf("遍历文件时出错, path=%s, err: %s", path, errWalk.Error())
+				return errWalk
+			}
+			if hiddenEntry(root, path, d) {
+				if d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				return nil
+			}
+			seen[path] = true
+			file := importFile{Path: path}
+			if opts.HashFiles {
+				hash, err := hashFile(path)
+				if err != nil {
+					log.Println("failed to hash file, path="+path+", err: ", err.Error())
+					emit(importEvent{Type: importEventFailed, Path: path, Error: err.Error()})
+					return nil
+				}
+				file.Hash = hash
+			}
+			if rows := indexed[path]; len(rows) > 0 {
+				if i := unchangedRow(rows, file.Hash, opts.HashFiles); i >= 0 {
+					// Earlier imports without dedupe may have left copies.
+					for j, row := range rows {
+						if j != i {
+							duplicates = append(duplicates, row.ID)
+						}
+					}
+					emit(importEvent{Type: importEventSkipped, Path: path})
+					return nil
+				}
+			}
+			if len(opts.MetaFields) > 0 {
+				file.Meta = collectImageMeta(path, opts.Meta)
+			}
+			batch = append(batch, file)
+			if len(batch) == opts.EmbedBatchSize && !send() {
+				return ctx.Err()
+			}
+			return nil
+		})
+		if err == nil && len(batch) > 0 {
+			send()
+		}
+		if err != nil && ctx.Err() == nil {
+			fail(err)
+		}
+		walked = err == nil && ctx.Err() == nil
+	}()
+
+	rows := make(chan []VectorRow, opts.Workers)
+	var workers sync.WaitGroup
+	for i := 0; i < opts.Workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for batch := range batches {
+				if ctx.Err() != nil {
+					continue
+				}
+				embedded := embedBatch(ctx, embedder, batch, opts.Dim, emit)
+				if len(embedded) == 0 {
+					continue
+				}
+				select {
+				case rows <- embedded:
+				case <-ctx.Done():
+				}
+			}
+		}()
+	}
+	go func() {
+		workers.Wait()
+		close(rows)
+	}()
+
+	// stale are the rows to delete once the new rows are in.
+	var stale []int64
+	pending := make([]VectorRow, 0, opts.InsertBatchSize)
+	flush := func() {
+		if len(pending) == 0 || ctx.Err() != nil {
+			return
+		}
+		if err := store.Insert(ctx, collection, opts.Partition, pending); err != nil {
+			fail(fmt.Errorf("failed to insert rows: %w", err))
+			return
+		}
+		result.Inserted += len(pending)
+		for _, row := range pending {
+			for _, old := range indexed[row.Url] {
+				stale = append(stale, old.ID)
+			}
+		}
+		emit(importEvent{Type: importEventInserted, Count: len(pending)})
+		log.Printf(msgFmt, fmt.Sprintf("inserted %d of %d embedded images", result.Inserted, embeddedCount.Load()))
+		pending = make([]VectorRow, 0, opts.InsertBatchSize)
+	}
+	for embedded := range rows {
+		for _, row := range embedded {
+			pending = append(pending, row)
+			if len(pending) >= opts.InsertBatchSize {
+				flush()
+			}
+		}
+	}
+	flush()
+
+	stale = append(stale, duplicates...)
+	if opts.Prune && walked && firstErr == nil {
+		for url, rows := range indexed {
+			if !seen[url] {
+				for _, row := range rows {
+					stale = append(stale, row.ID)
+				}
+			}
+		}
+	}
+	if len(stale) > 0 && ctx.Err() == nil {
+		if err := store.Delete(ctx, collection, stale); err != nil {
+			fail(fmt.Errorf("failed to delete outdated rows: %w", err))
+		} else {
+			result.Deleted = len(stale)
+			emit(importEvent{Type: importEventDeleted, Count: len(stale)})
+			log.Printf(msgFmt, fmt.Sprintf("deleted %d outdated rows", len(stale)))
+		}
+	}
+	result.Embedded, result.Failed = int(embeddedCount.Load()), int(failedCount.Load())
+	result.Skipped = int(skippedCount.Load())
+
+	if firstErr != nil {
+		return result, firstErr
+	}
+	// Without an error of its own the pipeline only stops early when the
+	// caller's context is done.
+	return result, ctx.Err()
+}
+
+// embedBatch embeds batch and returns the rows of the files that succeeded,
+// emitting an embedded or failed event per file. When the batch request
+// fails as a whole, its files are retried one by one so that a single bad
+// image does not fail its neighbours.
+func embedBatch(ctx context.Context, embedder Embedder, batch []importFile, dim int64, emit func(importEvent)) []VectorRow {
+	paths := make([]string, 0, len(batch))
+	for _, file := range batch {
+		paths = append(paths, file.Path)
+	}
+	vecs, err := embedder.EmbedImages(ctx, paths)
+	errs := make([]error, len(batch))
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		vecs = make([][]float32, len(batch))
+		if len(batch) == 1 {
+			errs[0] = err
+		} else {
+			for i, path := range paths {
+				vecs[i], errs[i] = embedder.EmbedImage(ctx, path)
+			}
+		}
+	}
+
+	rows := make([]VectorRow, 0, len(batch))
+	for i, file := range batch {
+		path := file.Path
+		if ctx.Err() != nil {
+			return nil
+		}
+		if errs[i] == nil {
+			errs[i] = checkEmbeddingDim(vecs[i], dim)
+		}
+		if errs[i] != nil {
+			log.Println("get vector error, path="+path+", err: ", errs[i].Error())
+			emit(importEvent{Type: importEventFailed, Path: path, Error: errs[i].Error()})
+			continue
+		}
+		rows = append(rows, VectorRow{Vec: vecs[i], Url: path, Hash: file.Hash, Meta: file.Meta})
+		emit(importEvent{Type: importEventEmbedded, Path: path})
+	}
+	return rows
+}
+
+// unchangedRow returns the index of the row in rows that is still current for
+// a file with hash, or -1 if the file has to be embedded again. Without hashes
+// any row of the file counts as current.
+func unchangedRow(rows []IndexedFile, hash string, hashed bool) int {
+	for i, row := range rows {
+		if !hashed || row.Hash == hash {
+			return i
+		}
+	}
+	return -1
+}
+
+// hiddenEntry reports whether d, found at path under root, is a dot entry,
+// such as the folder of the upload metadata. Those are not images.
+func hiddenEntry(root string, path string, d fs.DirEntry) bool {
+	return path != root && strings.HasPrefix(d.Name(), ".")
+}
+
+// hashFile returns the hex SHA-256 of the file at path.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
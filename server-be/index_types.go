@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/milvus-io/milvus-sdk-go/v2/entity"
+)
+
+// Index parameters used when neither the request nor its instance gives them.
+const (
+	defaultIndexM              = 12
+	defaultIndexEfConstruction = 50
+	defaultIndexNlist          = 12
+	defaultIndexNbits          = 8
+	defaultSearchEf            = 10
+	defaultSearchNprobe        = 10
+	defaultAutoLevel           = 1
+)
+
+var errUnknownIndexType = errors.New("unknown index type")
+
+// indexType is a vector index type the API can build and search. newIndex
+// builds the Milvus index and searchParam the search parameters of a query for
+// topk hits. buildParams and searchParams name the request parameters that
+// apply to the type.
+type indexType struct {
+	Name         string
+	buildParams  []string
+	searchParams []string
+	newIndex     func(metric entity.MetricType, p IndexParams) (entity.Index, error)
+	searchParam  func(topk int, t SearchTuning) (entity.SearchParam, error)
+}
+
+var indexTypes = map[string]indexType{}
+
+func registerIndexType(t indexType) {
+	indexTypes[t.Name] = t
+}
+
+func init() {
+	registerIndexType(indexType{
+		Name: "AUTOINDEX",
+		newIndex: func(metric entity.MetricType, p IndexParams) (entity.Index, error) {
+			return entity.NewIndexAUTOINDEX(metric)
+		},
+		searchParam: func(topk int, t SearchTuning) (entity.SearchParam, error) {
+			return entity.NewIndexAUTOINDEXSearchParam(defaultAutoLevel)
+		},
+	})
+	registerIndexType(indexType{
+		Name: "FLAT",
+		newIndex: func(metric entity.MetricType, p IndexParams) (entity.Index, error) {
+			return entity.NewIndexFlat(metric)
+		},
+		searchParam: func(topk int, t SearchTuning) (entity.SearchParam, error) {
+			return entity.NewIndexFlatSearchParam()
+		},
+	})
+	// HNSW and DISKANN need a candidate list at least as long as topk.
+	registerIndexType(indexType{
+		Name:         "HNSW",
+		buildParams:  []string{"index_m", "index_ef_construction"},
+		searchParams: []string{"search_ef"},
+		newIndex: func(metric entity.MetricType, p IndexParams) (entity.Index, error) {
+			return entity.NewIndexHNSW(metric, orDefault(p.M, defaultIndexM), orDefault(p.EfConstruction, defaultIndexEfConstruction))
+		},
+		searchParam: func(topk int, t SearchTuning) (entity.SearchParam, error) {
+			return entity.NewIndexHNSWSearchParam(orDefault(t.Ef, max(defaultSearchEf, topk)))
+		},
+	})
+	registerIndexType(indexType{
+		Name:         "DISKANN",
+		searchParams: []string{"search_ef"},
+		newIndex: func(metric entity.MetricType, p IndexParams) (entity.Index, error) {
+			return entity.NewIndexDISKANN(metric)
+		},
+		searchParam: func(topk int, t SearchTuning) (entity.SearchParam, error) {
+			return entity.NewIndexDISKANNSearchParam(orDefault(t.Ef, max(defaultSearchEf, topk)))
+		},
+	})
+	registerIndexType(indexType{
+		Name:         "IVF_FLAT",
+		buildParams:  []string{"index_nlist"},
+		searchParams: []string{"search_nprobe"},
+		newIndex: func(metric entity.MetricType, p IndexParams) (entity.Index, error) {
+			return entity.NewIndexIvfFlat(metric, orDefault(p.Nlist, defaultIndexNlist))
+		},
+		searchParam: func(topk int, t SearchTuning) (entity.SearchParam, error) {
+			return entity.NewIndexIvfFlatSearchParam(orDefault(t.Nprobe, defaultSearchNprobe))
+		},
+	})
+	registerIndexType(indexType{
+		Name:         "IVF_SQ8",
+		buildParams:  []string{"index_nlist"},
+		searchParams: []string{"search_nprobe"},
+		newIndex: func(metric entity.MetricType, p IndexParams) (entity.Index, error) {
+			return entity.NewIndexIvfSQ8(metric, orDefault(p.Nlist, defaultIndexNlist))
+		},
+		searchParam: func(topk int, t SearchTuning) (entity.SearchParam, error) {
+			return entity.NewIndexIvfSQ8SearchParam(orDefault(t.Nprobe, defaultSearchNprobe))
+		},
+	})
+	registerIndexType(indexType{
+		Name:         "IVF_PQ",
+		buildParams:  []string{"index_nlist", "index_pq_m", "index_nbits"},
+		searchParams: []string{"search_nprobe"},
+		newIndex: func(metric entity.MetricType, p IndexParams) (entity.Index, error) {
+			return entity.NewIndexIvfPQ(metric, orDefault(p.Nlist, defaultIndexNlist), p.PQM, orDefault(p.Nbits, defaultIndexNbits))
+		},
+		searchParam: func(topk int, t SearchTuning) (entity.SearchParam, error) {
+			return entity.NewIndexIvfPQSearchParam(orDefault(t.Nprobe, defaultSearchNprobe))
+		},
+	})
+	registerIndexType(indexType{
+		Name:         "SCANN",
+		buildParams:  []string{"index_nlist"},
+		searchParams: []string{"search_nprobe", "search_reorder_k"},
+		newIndex: func(metric entity.MetricType, p IndexParams) (entity.Index, error) {
+			return entity.NewIndexSCANN(metric, orDefault(p.Nlist, defaultIndexNlist), true)
+		},
+		searchParam: func(topk int, t SearchTuning) (entity.SearchParam, error) {
+			return entity.NewIndexSCANNSearchParam(orDefault(t.Nprobe, defaultSearchNprobe), orDefault(t.ReorderK, topk))
+		},
+	})
+}
+
+func lookupIndexType(name string) (indexType, error) {
+	t, ok := indexTypes[name]
+	if !ok {
+		return indexType{}, fmt.Errorf("%w: %q", errUnknownIndexType, name)
+	}
+	return t, nil
+}
+
+// indexTypeNames returns the registered index types in order.
+func indexTypeNames() []string {
+	names := make([]string, 0, len(indexTypes))
+	for name := range indexTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newSearchParam builds the search parameters of a query for topk hits,
+// including the range search bounds of tuning.
+func (t indexType) newSearchParam(topk int, tuning SearchTuning) (entity.SearchParam, error) {
+	sp, err := t.searchParam(topk, tuning)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s search params: %w", t.Name, err)
+	}
+	if tuning.Radius != nil {
+		sp.AddRadius(*tuning.Radius)
+	}
+	if tuning.RangeFilter != nil {
+		sp.AddRangeFilter(*tuning.RangeFilter)
+	}
+	return sp, nil
+}
+
+// unsupported reports the parameters in given that are not among supported,
+// the build or search parameters of t.
+func (t indexType) unsupported(given []string, supported []string) []fieldError {
+	var errs []fieldError
+	for _, name := range given {
+		if !slices.Contains(supported, name) {
+			errs = append(errs, fieldError{Field: name, Message: "is not supported by " + t.Name})
+		}
+	}
+	return errs
+}
+
+// defaultPQM returns the number of IVF_PQ sub-vectors used when none is
+// given: the largest of 32, 16, 8, 4, 2 and 1 that divides dim, since Milvus
+// requires m to divide the dimension.
+func defaultPQM(dim int) int {
+	for _, m := range []int{32, 16, 8, 4, 2} {
+		if dim%m == 0 {
+			return m
+		}
+	}
+	return 1
+}
+
+func orDefault(value int, def int) int {
+	if value == 0 {
+		return def
+	}
+	return value
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// redactedSecret replaces secrets in instance responses. Sending it back in an
+// update keeps the stored secret.
+const redactedSecret = "******"
+
+var instanceNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Instance is a named Milvus collection together with the embedding service
+// used for it. Its JSON keys are the request parameters of the handlers, so a
+// request naming an instance needs none of them.
+type Instance struct {
+	Name           string `json:"name"`
+	MilvusServer   string `json:"milvus_server"`
+	MilvusPort     string `json:"milvus_port"`
+	MilvusUsername string `json:"milvus_username"`
+	MilvusPass     string `json:"milvus_pass"`
+	CollectionName string `json:"collection_name"`
+	CollectionDim  string `json:"collection_dim"`
+	IndexName      string `json:"index_name"`
+	MetricType     string `json:"metric_type"`
+	// Index build parameters, and search parameters used by searches that do
+	// not give their own.
+	IndexM              flexString `json:"index_m,omitempty"`
+	IndexEfConstruction flexString `json:"index_ef_construction,omitempty"`
+	IndexNlist          flexString `json:"index_nlist,omitempty"`
+	IndexPQM            flexString `json:"index_pq_m,omitempty"`
+	IndexNbits          flexString `json:"index_nbits,omitempty"`
+	SearchEf            flexString `json:"search_ef,omitempty"`
+	SearchNprobe        flexString `json:"search_nprobe,omitempty"`
+	SearchReorderK      flexString `json:"search_reorder_k,omitempty"`
+	SearchRadius        flexString `json:"search_radius,omitempty"`
+	SearchRangeFilter   flexString `json:"search_range_filter,omitempty"`
+	// Metadata fields declared when creating the collection.
+	SchemaFields       []MetaField `json:"schema_fields,omitempty"`
+	EmbedProvider      string      `json:"embed_provider"`
+	EmbedServerUrl     string      `json:"embed_server_url"`
+	EmbedServerApikey  string      `json:"embed_server_apikey"`
+	EmbedModel         string      `json:"embed_model"`
+	EmbedTextTemplate  string      `json:"embed_text_template"`
+	EmbedImageTemplate string      `json:"embed_image_template"`
+	EmbedResponsePath  string      `json:"embed_response_path"`
+	CreatedAt          time.Time   `json:"created_at"`
+	UpdatedAt          time.Time   `json:"updated_at"`
+}
+
+// redacted returns a copy of inst that is safe to send to clients.
+func (inst Instance) redacted() Instance {
+	if inst.MilvusPass != "" {
+		inst.MilvusPass = redactedSecret
+	}
+	if inst.EmbedServerApikey != "" {
+		inst.EmbedServerApikey = redactedSecret
+	}
+	return inst
+}
+
+func (inst Instance) validate() error {
+	if !instanceNamePattern.MatchString(inst.Name) {
+		return fmt.Errorf("%w: name %q may only use letters, digits, _ and -", errInvalidInstance, inst.Name)
+	}
+	if inst.CollectionName == "" {
+		return fmt.Errorf("%w: collection_name is required", errInvalidInstance)
+	}
+	if !collectionNamePattern.MatchString(inst.CollectionName) {
+		return fmt.Errorf("%w: collection_name %q %s", errInvalidInstance, inst.CollectionName, milvusNameMessage)
+	}
+	return nil
+}
+
+// instanceRegistry keeps the instances in a JSON file readable by the server
+// user only, since it holds the Milvus password and the embedding API key.
+type instanceRegistry struct {
+	path      string
+	mu        sync.RWMutex
+	instances map[string]Instance
+}
+
+var (
+	errInstanceNotFound = errors.New("instance not found")
+	errInstanceExists   = errors.New("instance already exists")
+	errInvalidInstance  = errors.New("invalid instance")
+)
+
+var instances *instanceRegistry
+
+func openInstanceRegistry(path string) (*instanceRegistry, error) {
+	r := &instanceRegistry{path: path, instances: map[string]Instance{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []Instance
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for _, inst := range list {
+		r.instances[inst.Name] = inst
+	}
+	log.Printf(msgFmt, fmt.Sprintf("instance registry opened: %s, %d instances", path, len(r.instances)))
+	return r, nil
+}
+
+// save writes the registry through a temporary file. r.mu must be held.
+func (r *instanceRegistry) save() error {
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(r.sorted(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), filepath.Base(r.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), r.path)
+}
+
+// sorted returns the instances ordered by name. r.mu must be held.
+func (r *instanceRegistry) sorted() []Instance {
+	list := make([]Instance, 0, len(r.instances))
+	for _, inst := range r.instances {
+		list = append(list, inst)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+func (r *instanceRegistry) list() []Instance {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.sorted()
+}
+
+func (r *instanceRegistry) get(name string) (Instance, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	inst, ok := r.instances[name]
+	if !ok {
+		return Instance{}, fmt.Errorf("%w: %s", errInstanceNotFound, name)
+	}
+	return inst, nil
+}
+
+func (r *instanceRegistry) create(inst Instance) (Instance, error) {
+	if err := inst.validate(); err != nil {
+		return inst, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.instances[inst.Name]; ok {
+		return inst, fmt.Errorf("%w: %s", errInstanceExists, inst.Name)
+	}
+	inst.CreatedAt = time.Now()
+	inst.UpdatedAt = inst.CreatedAt
+	r.instances[inst.Name] = inst
+	if err := r.save(); err != nil {
+		delete(r.instances, inst.Name)
+		return inst, err
+	}
+	return inst, nil
+}
+
+// update overwrites the fields of instance name that are set in fields, the
+// JSON object of an update request. The name itself cannot change.
+func (r *instanceRegistry) update(name string, fields map[string]interface{}) (Instance, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old, ok := r.instances[name]
+	if !ok {
+		return Instance{}, fmt.Errorf("%w: %s", errInstanceNotFound, name)
+	}
+	merged := map[string]interface{}{}
+	data, _ := json.Marshal(old)
+	json.Unmarshal(data, &merged)
+	for key, value := range fields {
+		switch key {
+		case "name", "created_at", "updated_at":
+			continue
+		}
+		if value == redactedSecret {
+			continue
+		}
+		merged[key] = value
+	}
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return old, err
+	}
+	var inst Instance
+	if err := json.Unmarshal(data, &inst); err != nil {
+		return old, err
+	}
+	if err := inst.validate(); err != nil {
+		return old, err
+	}
+	inst.UpdatedAt = time.Now()
+	r.instances[name] = inst
+	if err := r.save(); err != nil {
+		r.instances[name] = old
+		return old, err
+	}
+	return inst, nil
+}
+
+func (r *instanceRegistry) delete(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old, ok := r.instances[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", errInstanceNotFound, name)
+	}
+	delete(r.instances, name)
+	if err := r.save(); err != nil {
+		r.instances[name] = old
+		return err
+	}
+	return nil
+}
+
+// instanceSecrets lists the credentials of an instance with the parameters
+// naming the server they belong to.
+var instanceSecrets = map[string][]string{
+	"milvus_username":     {"milvus_server", "milvus_port"},
+	"milvus_pass":         {"milvus_server", "milvus_port"},
+	"embed_server_apikey": {"embed_server_url", "embed_provider"},
+}
+
+// applyInstance fills the parameters of a request naming an instance with the
+// settings of that instance. Parameters given in the request win, so a request
+// can still override, say, the metric type. A request pointing at another
+// milvus or embedding server does not get the credentials of the instance,
+// which would otherwise be sent to a server of the client's choosing.
+func applyInstance(params map[string]interface{}) error {
+	name, _ := params["instance"].(string)
+	if name == "" {
+		return nil
+	}
+	inst, err := instances.get(name)
+	if err != nil {
+		return err
+	}
+	var fields map[string]interface{}
+	data, _ := json.Marshal(inst)
+	json.Unmarshal(data, &fields)
+	for key, value := range fields {
+		switch key {
+		case "name", "created_at", "updated_at":
+			continue
+		}
+		if _, ok := params[key]; ok {
+			continue
+		}
+		if overridesServer(params, fields, instanceSecrets[key]) {
+			continue
+		}
+		params[key] = value
+		if key == "search_ef" || key == "search_reorder_k" {
+			raiseToTopk(params, key)
+		}
+	}
+	return nil
+}
+
+// raiseToTopk raises the instance default of a candidate list size to the
+// search_topk of the request, since Milvus needs the list to hold topk hits
+// and the client may ask for more hits than the default allows.
+func raiseToTopk(params map[string]interface{}, key string) {
+	value, err := strconv.ParseInt(fmt.Sprint(params[key]), 10, 64)
+	if err != nil {
+		return
+	}
+	topk, err := strconv.ParseInt(fmt.Sprint(params["search_topk"]), 10, 64)
+	if err == nil && topk > value {
+		params[key] = topk
+	}
+}
+
+// overridesServer reports whether params gives any of keys a value other than
+// the one in fields.
+func overridesServer(params map[string]interface{}, fields map[string]interface{}, keys []string) bool {
+	for _, key := range keys {
+		if value, ok := params[key]; ok && fmt.Sprint(value) != fmt.Sprint(fields[key]) {
+			return true
+		}
+	}
+	return false
+}
+
+// respondInstanceError answers a failed registry call.
+func respondInstanceError(gincontext *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errInstanceNotFound):
+		respondError(gincontext, codeInstanceNotFound, err.Error(), nil)
+	case errors.Is(err, errInstanceExists):
+		respondError(gincontext, codeInstanceExists, err.Error(), nil)
+	case errors.Is(err, errInvalidInstance):
+		respondError(gincontext, codeInvalidParams, err.Error(), nil)
+	default:
+		log.Println("instance registry failed, err: ", err.Error())
+		respondError(gincontext, codeInternal, "instance registry failed: "+err.Error(), nil)
+	}
+}
+
+func listInstances(gincontext *gin.Context) {
+	list := instances.list()
+	for i := range list {
+		list[i] = list[i].redacted()
+	}
+	gincontext.JSON(http.StatusOK, gin.H{"instances": list})
+}
+
+func getInstance(gincontext *gin.Context) {
+	inst, err := instances.get(gincontext.Param("name"))
+	if err != nil {
+		respondInstanceError(gincontext, err)
+		return
+	}
+	gincontext.JSON(http.StatusOK, inst.redacted())
+}
+
+func registerInstance(gincontext *gin.Context) {
+	var inst Instance
+	if err := gincontext.BindJSON(&inst); err != nil {
+		respondError(gincontext, codeInvalidJSON, "Invalid JSON format", nil)
+		return
+	}
+	inst, err := instances.create(inst)
+	if err != nil {
+		log.Println("failed to register instance, err: ", err.Error())
+		respondInstanceError(gincontext, err)
+		return
+	}
+	log.Printf(msgFmt, "instance registered: "+inst.Name)
+	gincontext.JSON(http.StatusCreated, inst.redacted())
+}
+
+func updateInstance(gincontext *gin.Context) {
+	var fields map[string]interface{}
+	if err := gincontext.BindJSON(&fields); err != nil {
+		respondError(gincontext, codeInvalidJSON, "Invalid JSON format", nil)
+		return
+	}
+	inst, err := instances.update(gincontext.Param("name"), fields)
+	if err != nil {
+		log.Println("failed to update instance, err: ", err.Error())
+		respondInstanceError(gincontext, err)
+		return
+	}
+	gincontext.JSON(http.StatusOK, inst.redacted())
+}
+
+// unregisterInstance removes an instance from the registry. Its collection and
+// images are left alone; /api/instanceDelete drops those.
+func unregisterInstance(gincontext *gin.Context) {
+	name := gincontext.Param("name")
+	if err := instances.delete(name); err != nil {
+		respondInstanceError(gincontext, err)
+		return
+	}
+	log.Printf(msgFmt, "instance unregistered: "+name)
+	gincontext.JSON(http.StatusOK, gin.H{"message": "success"})
+}
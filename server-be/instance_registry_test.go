@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyInstanceSecrets(t *testing.T) {
+	prev := instances
+	t.Cleanup(func() { instances = prev })
+	var err error
+	if instances, err = openInstanceRegistry(filepath.Join(t.TempDir(), "instances.json")); err != nil {
+		t.Fatal(err)
+	}
+	_, err = instances.create(Instance{
+		Name:              "prod",
+		MilvusServer:      "milvus.internal",
+		MilvusPort:        "19530",
+		MilvusUsername:    "root",
+		MilvusPass:        "secret",
+		CollectionName:    "pets",
+		EmbedServerUrl:    "https://embed.internal",
+		EmbedServerApikey: "key",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		params map[string]interface{}
+		// milvus and embed are whether the milvus and the embedding
+		// credentials are filled in.
+		milvus, embed bool
+	}{
+		{"no override", map[string]interface{}{}, true, true},
+		{"same server", map[string]interface{}{"milvus_server": "milvus.internal", "milvus_port": 19530}, true, true},
+		{"other metric", map[string]interface{}{"metric_type": "L2"}, true, true},
+		{"other milvus host", map[string]interface{}{"milvus_server": "evil.example"}, false, true},
+		{"other milvus port", map[string]interface{}{"milvus_port": "1"}, false, true},
+		{"other embed url", map[string]interface{}{"embed_server_url": "https://evil.example"}, true, false},
+		{"other embed provider", map[string]interface{}{"embed_provider": "openai"}, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.params["instance"] = "prod"
+			if err := applyInstance(tt.params); err != nil {
+				t.Fatal(err)
+			}
+			_, hasPass := tt.params["milvus_pass"]
+			_, hasUser := tt.params["milvus_username"]
+			if hasPass != tt.milvus || hasUser != tt.milvus {
+				t.Errorf("milvus credentials: got pass %v user %v, want %v", hasPass, hasUser, tt.milvus)
+			}
+			if _, hasKey := tt.params["embed_server_apikey"]; hasKey != tt.embed {
+				t.Errorf("embed api key: got %v, want %v", hasKey, tt.embed)
+			}
+			if tt.params["collection_name"] != "pets" {
+				t.Errorf("collection_name: got %v, want pets", tt.params["collection_name"])
+			}
+		})
+	}
+
+	// Credentials given in the request are kept.
+	params := map[string]interface{}{"instance": "prod", "milvus_server": "other", "milvus_pass": "mine"}
+	if err := applyInstance(params); err != nil {
+		t.Fatal(err)
+	}
+	if params["milvus_pass"] != "mine" {
+		t.Errorf("milvus_pass: got %v, want mine", params["milvus_pass"])
+	}
+}
+
+func TestApplyInstanceSearchEf(t *testing.T) {
+	prev := instances
+	t.Cleanup(func() { instances = prev })
+	var err error
+	if instances, err = openInstanceRegistry(filepath.Join(t.TempDir(), "instances.json")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := instances.create(Instance{Name: "prod", CollectionName: "pets", SearchEf: "64"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		params map[string]interface{}
+		want   string
+	}{
+		{"default", map[string]interface{}{"search_topk": 10}, "64"},
+		{"topk above the default", map[string]interface{}{"search_topk": "100"}, "100"},
+		{"sent by the client", map[string]interface{}{"search_topk": 100, "search_ef": 20}, "20"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.params["instance"] = "prod"
+			if err := applyInstance(tt.params); err != nil {
+				t.Fatal(err)
+			}
+			if got := fmt.Sprint(tt.params["search_ef"]); got != tt.want {
+				t.Errorf("search_ef: got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/milvus-io/milvus-sdk-go/v2/client"
+	"github.com/milvus-io/milvus-sdk-go/v2/entity"
+)
+
+var (
+	// milvusIdleTimeout is how long an unused connection is kept open.
+	milvusIdleTimeout = 5 * time.Minute
+	// milvusHealthInterval is how often pooled connections are checked.
+	milvusHealthInterval = 30 * time.Second
+)
+
+const (
+	milvusDialAttempts = 3
+	milvusDialBackoff  = 500 * time.Millisecond
+	milvusCheckTimeout = 5 * time.Second
+)
+
+// milvusPool shares Milvus clients between requests. There is one client per
+// address and user; a password change gets a client of its own. Clients are
+// checked in the background and dropped from the pool when unhealthy, so that
+// the next request reconnects; a dropped client is closed once the requests
+// still using it are done. Idle clients are closed after milvusIdleTimeout.
+type milvusPool struct {
+	mu    sync.Mutex
+	conns map[string]*pooledMilvus
+	dial  func(ctx context.Context, cfg StoreConfig) (client.Client, error)
+}
+
+// pooledMilvus is one pooled client. mu guards c and dial but is never held
+// across a call to the server: concurrent requests for a new address share a
+// single dial by waiting for it to finish.
+type pooledMilvus struct {
+	key      string
+	cfg      StoreConfig
+	mu       sync.Mutex
+	c        client.Client
+	dial     *milvusDial
+	refs     int
+	lastUsed time.Time
+	// stale is set when the client has been dropped from the pool. The last
+	// release closes it.
+	stale bool
+
+	// schemas caches the collection schemas read through the client, which
+	// the store needs for every insert and search.
+	schemaMu sync.Mutex
+	schemas  map[string]*entity.Schema
+}
+
+// milvusDial is a dial in progress; done is closed once c or err is set.
+type milvusDial struct {
+	done chan struct{}
+	c    client.Client
+	err  error
+}
+
+var milvusClients = newMilvusPool(func(ctx context.Context, cfg StoreConfig) (client.Client, error) {
+	return get_milvus_client(ctx, cfg.MilvusServer, cfg.MilvusPort, cfg.MilvusUsername, cfg.MilvusPass)
+})
+
+func newMilvusPool(dial func(ctx context.Context, cfg StoreConfig) (client.Client, error)) *milvusPool {
+	return &milvusPool{conns: map[string]*pooledMilvus{}, dial: dial}
+}
+
+func milvusPoolKey(cfg StoreConfig) string {
+	pass := sha256.Sum256([]byte(cfg.MilvusPass))
+	return cfg.MilvusServer + ":" + cfg.MilvusPort + "|" + cfg.MilvusUsername + "|" + hex.EncodeToString(pass[:8])
+}
+
+// acquire returns a connected client for cfg. Every acquire must be matched
+// by a release.
+func (p *milvusPool) acquire(ctx context.Context, cfg StoreConfig) (*pooledMilvus, client.Client, error) {
+	key := milvusPoolKey(cfg)
+	p.mu.Lock()
+	conn, ok := p.conns[key]
+	if !ok {
+		conn = &pooledMilvus{key: key, cfg: cfg}
+		p.conns[key] = conn
+	}
+	conn.refs++
+	conn.lastUsed = time.Now()
+	p.mu.Unlock()
+
+	c, err := p.connect(ctx, conn)
+	if err != nil {
+		p.release(conn)
+		return nil, nil, err
+	}
+	return conn, c, nil
+}
+
+// connect dials conn unless it is connected already. Requests arriving while
+// a dial is running wait for its outcome rather than dialing again.
+func (p *milvusPool) connect(ctx context.Context, conn *pooledMilvus) (client.Client, error) {
+	conn.mu.Lock()
+	if conn.c != nil {
+		c := conn.c
+		conn.mu.Unlock()
+		return c, nil
+	}
+	if d := conn.dial; d != nil {
+		conn.mu.Unlock()
+		select {
+		case <-d.done:
+			return d.c, d.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	d := &milvusDial{done: make(chan struct{})}
+	conn.dial = d
+	conn.mu.Unlock()
+
+	d.c, d.err = p.dialRetry(ctx, conn.cfg)
+	conn.mu.Lock()
+	conn.c = d.c
+	conn.dial = nil
+	conn.mu.Unlock()
+	close(d.done)
+	return d.c, d.err
+}
+
+// dialRetry dials cfg, retrying with an exponential backoff.
+func (p *milvusPool) dialRetry(ctx context.Context, cfg StoreConfig) (client.Client, error) {
+	backoff := milvusDialBackoff
+	var err error
+	for attempt := 1; attempt <= milvusDialAttempts; attempt++ {
+		var c client.Client
+		c, err = p.dial(ctx, cfg)
+		if err == nil {
+			return c, nil
+		}
+		log.Printf(msgFmt, fmt.Sprintf("connect to Milvus %s:%s failed, attempt %d of %d: %s", cfg.MilvusServer, cfg.MilvusPort, attempt, milvusDialAttempts, err.Error()))
+		if attempt == milvusDialAttempts {
+			break
+		}
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			return nil, errors.Join(err, ctx.Err())
+		}
+	}
+	return nil, err
+}
+
+func (p *milvusPool) release(conn *pooledMilvus) {
+	p.mu.Lock()
+	conn.refs--
+	conn.lastUsed = time.Now()
+	last := conn.stale && conn.refs == 0
+	p.mu.Unlock()
+
+	if last {
+		conn.closeClient()
+	}
+}
+
+// maintain checks the pool every interval until ctx is done.
+func (p *milvusPool) maintain(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.evictIdle(milvusIdleTimeout)
+			p.checkHealth(ctx)
+		}
+	}
+}
+
+// evictIdle closes and forgets the clients unused for longer than idle.
+func (p *milvusPool) evictIdle(idle time.Duration) {
+	p.mu.Lock()
+	var evicted []*pooledMilvus
+	for key, conn := range p.conns {
+		if conn.refs == 0 && time.Since(conn.lastUsed) > idle {
+			delete(p.conns, key)
+			evicted = append(evicted, conn)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, conn := range evicted {
+		conn.mu.Lock()
+		if conn.c != nil {
+			log.Printf(msgFmt, "close idle Milvus connection "+conn.cfg.MilvusServer+":"+conn.cfg.MilvusPort)
+			conn.c.Close()
+			conn.c = nil
+		}
+		conn.mu.Unlock()
+	}
+}
+
+// checkHealth drops the clients whose server does not report healthy from the
+// pool, so that the next acquire dials again. A dropped client still in use
+// is closed by its last release rather than under the requests using it.
+func (p *milvusPool) checkHealth(ctx context.Context) {
+	p.mu.Lock()
+	conns := make([]*pooledMilvus, 0, len(p.conns))
+	for _, conn := range p.conns {
+		conns = append(conns, conn)
+	}
+	p.mu.Unlock()
+
+	for _, conn := range conns {
+		conn.mu.Lock()
+		c := conn.c
+		conn.mu.Unlock()
+		if c == nil {
+			continue
+		}
+		checkCtx, cancel := context.WithTimeout(ctx, milvusCheckTimeout)
+		state, err := c.CheckHealth(checkCtx)
+		cancel()
+		if err == nil && state.IsHealthy {
+			continue
+		}
+		reason := "not healthy"
+		if err != nil {
+			reason = err.Error()
+		}
+		log.Printf(msgFmt, "drop Milvus connection "+conn.cfg.MilvusServer+":"+conn.cfg.MilvusPort+": "+reason)
+		p.mu.Lock()
+		if p.conns[conn.key] == conn {
+			delete(p.conns, conn.key)
+		}
+		conn.stale = true
+		unused := conn.refs == 0
+		p.mu.Unlock()
+		if unused {
+			conn.closeClient()
+		}
+	}
+}
+
+// closeClient closes the client of conn, if it is connected.
+func (conn *pooledMilvus) closeClient() {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if conn.c != nil {
+		conn.c.Close()
+		conn.c = nil
+	}
+}
+
+// close closes every pooled client.
+func (p *milvusPool) close() {
+	p.mu.Lock()
+	conns := p.conns
+	p.conns = map[string]*pooledMilvus{}
+	p.mu.Unlock()
+	for _, conn := range conns {
+		conn.closeClient()
+	}
+}
+
+// schema returns the cached schema of collection, or nil.
+func (conn *pooledMilvus) schema(collection string) *entity.Schema {
+	conn.schemaMu.Lock()
+	defer conn.schemaMu.Unlock()
+	return conn.schemas[collection]
+}
+
+func (conn *pooledMilvus) cacheSchema(collection string, schema *entity.Schema) {
+	conn.schemaMu.Lock()
+	defer conn.schemaMu.Unlock()
+	if conn.schemas == nil {
+		conn.schemas = map[string]*entity.Schema{}
+	}
+	conn.schemas[collection] = schema
+}
+
+// forgetSchema drops the cached schema of collection, after it was dropped or
+// created.
+func (conn *pooledMilvus) forgetSchema(collection string) {
+	conn.schemaMu.Lock()
+	defer conn.schemaMu.Unlock()
+	delete(conn.schemas, collection)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/milvus-io/milvus-sdk-go/v2/client"
+	"github.com/milvus-io/milvus-sdk-go/v2/entity"
+)
+
+// fakeMilvus is a client whose health is set by the test, with a single
+// collection "c" of dim 4 holding 5 rows. Any other method panics.
+type fakeMilvus struct {
+	client.Client
+	healthy   atomic.Bool
+	closed    atomic.Bool
+	describes atomic.Int32
+}
+
+func (f *fakeMilvus) DescribeCollection(ctx context.Context, collection string) (*entity.Collection, error) {
+	f.describes.Add(1)
+	schema := entity.NewSchema().WithName(collection).
+		WithField(entity.NewField().WithName("id").WithDataType(entity.FieldTypeInt64).WithIsPrimaryKey(true)).
+		WithField(entity.NewField().WithName(milvusVecField).WithDataType(entity.FieldTypeFloatVector).WithDim(4)).
+		WithField(entity.NewField().WithName(milvusUrlField).WithDataType(entity.FieldTypeVarChar)).
+		WithField(entity.NewField().WithName(milvusHashField).WithDataType(entity.FieldTypeVarChar))
+	return &entity.Collection{Name: collection, Schema: schema}, nil
+}
+
+func (f *fakeMilvus) GetCollectionStatistics(ctx context.Context, collection string) (map[string]string, error) {
+	return map[string]string{"row_count": "5"}, nil
+}
+
+func (f *fakeMilvus) DropCollection(ctx context.Context, collection string, opts ...client.DropCollectionOption) error {
+	return nil
+}
+
+func (f *fakeMilvus) CheckHealth(ctx context.Context) (*entity.MilvusState, error) {
+	return &entity.MilvusState{IsHealthy: f.healthy.Load()}, nil
+}
+
+func (f *fakeMilvus) Close() error {
+	f.closed.Store(true)
+	return nil
+}
+
+func TestMilvusPoolUnhealthyInUse(t *testing.T) {
+	var dialed []*fakeMilvus
+	pool := newMilvusPool(func(ctx context.Context, cfg StoreConfig) (client.Client, error) {
+		c := &fakeMilvus{}
+		c.healthy.Store(true)
+		dialed = append(dialed, c)
+		return c, nil
+	})
+	ctx := context.Background()
+	cfg := StoreConfig{MilvusServer: "localhost", MilvusPort: "19530"}
+
+	conn, c, err := pool.acquire(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := c.(*fakeMilvus)
+	first.healthy.Store(false)
+	pool.checkHealth(ctx)
+	// A request is still using the client: it is dropped but stays open.
+	if first.closed.Load() {
+		t.Fatal("client closed while in use")
+	}
+
+	other, c2, err := pool.acquire(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c2 == c || len(dialed) != 2 {
+		t.Fatal("acquire after a failed check did not dial again")
+	}
+
+	pool.release(conn)
+	if !first.closed.Load() {
+		t.Error("dropped client not closed by its last release")
+	}
+	pool.release(other)
+	if dialed[1].closed.Load() {
+		t.Error("healthy client closed on release")
+	}
+}
+
+func TestMilvusPoolUnhealthyUnused(t *testing.T) {
+	pool := newMilvusPool(func(ctx context.Context, cfg StoreConfig) (client.Client, error) {
+		return &fakeMilvus{}, nil
+	})
+	ctx := context.Background()
+	conn, c, err := pool.acquire(ctx, StoreConfig{MilvusServer: "localhost", MilvusPort: "19530"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.release(conn)
+	pool.checkHealth(ctx)
+	if !c.(*fakeMilvus).closed.Load() {
+		t.Error("unused unhealthy client not closed")
+	}
+	if len(pool.conns) != 0 {
+		t.Errorf("pool holds %d clients after a failed check, want 0", len(pool.conns))
+	}
+}
+
+func TestMilvusPoolSharedDial(t *testing.T) {
+	var dials atomic.Int32
+	release := make(chan struct{})
+	pool := newMilvusPool(func(ctx context.Context, cfg StoreConfig) (client.Client, error) {
+		dials.Add(1)
+		<-release
+		return nil, errors.New("connection refused")
+	})
+	cfg := StoreConfig{MilvusServer: "localhost", MilvusPort: "19530"}
+
+	// Requests queued behind a failing dial get its error instead of
+	// dialing again one after the other.
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := pool.acquire(context.Background(), cfg)
+			errs <- err
+		}()
+	}
+	for dials.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// The dial holds no lock that the health check needs.
+	pool.checkHealth(context.Background())
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err == nil {
+			t.Error("acquire succeeded with a failing dial")
+		}
+	}
+	// Each attempt of the one dial counts.
+	if got := dials.Load(); got != milvusDialAttempts {
+		t.Errorf("dials: got %d, want %d", got, milvusDialAttempts)
+	}
+}
+
+func TestMilvusStoreSchemaCache(t *testing.T) {
+	fake := &fakeMilvus{}
+	pool := newMilvusPool(func(ctx context.Context, cfg StoreConfig) (client.Client, error) {
+		return fake, nil
+	})
+	ctx := context.Background()
+	cfg := StoreConfig{MilvusServer: "localhost", MilvusPort: "19530"}
+	open := func() *milvusStore {
+		conn, c, err := pool.acquire(ctx, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &milvusStore{c: c, conn: conn}
+	}
+
+	for i := 0; i < 3; i++ {
+		store := open()
+		if hasHash, _, err := store.scalarFields(ctx, "c"); err != nil || !hasHash {
+			t.Fatalf("scalarFields: %v %v", hasHash, err)
+		}
+		if stats, err := store.Stats(ctx, "c"); err != nil || stats.Dim != 4 || stats.RowCount != 5 {
+			t.Fatalf("stats: got %+v, %v", stats, err)
+		}
+		pool.release(store.conn)
+	}
+	if got := fake.describes.Load(); got != 1 {
+		t.Errorf("DescribeCollection calls: got %d, want 1", got)
+	}
+
+	store := open()
+	if _, err := store.Search(ctx, "c", SearchRequest{Vector: make([]float32, 3), TopK: 1, IndexType: "FLAT", MetricType: "L2"}); !errors.Is(err, errDimMismatch) {
+		t.Errorf("search with dim 3: got %v, want a dim mismatch", err)
+	}
+	store.DropCollection(ctx, "c")
+	store.scalarFields(ctx, "c")
+	if got := fake.describes.Load(); got != 2 {
+		t.Errorf("DescribeCollection calls after a drop: got %d, want 2", got)
+	}
+	pool.release(store.conn)
+}
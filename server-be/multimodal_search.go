@@ -1,29 +1,20 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"embed"
-	"encoding/json"
-	"errors"
 	"flag"
 	"fmt"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"google.golang.org/grpc"
 	"io"
 	"io/fs"
-	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
-
-	"github.com/milvus-io/milvus-sdk-go/v2/client"
-	"github.com/milvus-io/milvus-sdk-go/v2/entity"
 )
 
 const (
@@ -34,218 +25,46 @@ const (
 //go:embed web/dist/*
 var staticFiles embed.FS
 
-func getValueFromParams(data map[string]interface{}, key string) interface{} {
-	keys := strings.Split(key, ".")
-	for _, k := range keys {
-		if v, ok := data[k].(map[string]interface{}); ok {
-			data = v
-		} else {
-			return data[k]
-		}
-	}
-	return nil
-}
-
-func stringToFloat32Slice(str string) ([]float32, error) {
-	str1 := strings.Replace(str, "[", "", -1)
-	str2 := strings.Replace(str1, "]", "", -1)
-	var result []float32
-	parts := strings.Split(str2, " ")
-	for _, part := range parts {
-		if f64, err := strconv.ParseFloat(part, 64); err == nil {
-			result = append(result, float32(f64))
-		} else {
-			return nil, err
-		}
-	}
-	return result, nil
-}
-
-type ParamImgInfo struct {
-	Url    string `json:"url"`
-	Apikey string `json:"api_key"`
-}
-type ParamTextInfo struct {
-	Data   string `json:"data"`
-	Apikey string `json:"api_key"`
-}
-type RespInfo struct {
-	Embedding string `json:"embedding"`
-}
-
-func get_img_vec(embed_server_url string, url string, apikey string) ([]float32, error) {
-	var paramBytes []byte = nil
-	if strings.HasPrefix(url, uploadServerPath) {
-		paramBytes, _ = json.Marshal(ParamImgInfo{Url: url, Apikey: apikey})
-	} else {
-		index := strings.Index(url, uploadServerPath)
-		if index != -1 {
-			url_fix := url[index+len(url):]
-			paramBytes, _ = json.Marshal(ParamImgInfo{Url: url_fix, Apikey: apikey})
-		} else {
-			return []float32{0}, errors.New("url path err")
-		}
-	}
-	resp, err := http.Post(embed_server_url+"/get_img_vec", "application/json", bytes.NewBuffer(paramBytes))
-	if err != nil {
-		return []float32{0}, err
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return []float32{0}, err
-	}
-	var respInfo RespInfo
-	err = json.Unmarshal(body, &respInfo)
-	if err != nil {
-		return []float32{0}, err
-	}
-
-	vec, err := stringToFloat32Slice(respInfo.Embedding)
-	if err != nil {
-		return []float32{0}, err
-	}
-	return vec, nil
-}
-
-func get_text_vec(embed_server_url string, data string, apikey string) ([]float32, error) {
-	paramBytes, err := json.Marshal(ParamTextInfo{Data: data, Apikey: apikey})
-	resp, err := http.Post(embed_server_url+"/get_txt_vec", "application/json", bytes.NewBuffer(paramBytes))
-	if err != nil {
-		return []float32{0}, err
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return []float32{0}, err
-	}
-	var respInfo RespInfo
-	err = json.Unmarshal(body, &respInfo)
-	if err != nil {
-		return []float32{0}, err
-	}
-
-	vec, err := stringToFloat32Slice(respInfo.Embedding)
-	if err != nil {
-		return []float32{0}, err
-	}
-	return vec, nil
-}
-
-func get_milvus_client(ctx context.Context, milvus_server string, milvus_port string, milvus_username string, milvus_pass string) (client.Client, error) {
-	milvusAddr := milvus_server + `:` + milvus_port
-	log.Printf(msgFmt, "start connecting to Milvus: "+milvusAddr)
-	c, err := client.NewClient(ctx, client.Config{
-		Address:  milvusAddr,
-		Username: milvus_username,
-		Password: milvus_pass,
-		DialOptions: []grpc.DialOption{
-			grpc.WithBlock(),
-			grpc.WithTimeout(time.Duration((10000) * 1000 * 1000)),
-		},
-	})
-	return c, err
-}
-
 func instanceCreate(gincontext *gin.Context) {
-	var jsonParams map[string]interface{}
-	if err := gincontext.BindJSON(&jsonParams); err != nil {
-		gincontext.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format"})
+	var req InstanceCreateRequest
+	if !bindParams(gincontext, &req) {
 		return
 	}
-
-	milvus_server := getValueFromParams(jsonParams, "milvus_server").(string)
-	milvus_port := getValueFromParams(jsonParams, "milvus_port").(string)
-	milvus_username := getValueFromParams(jsonParams, "milvus_username").(string)
-	milvus_pass := getValueFromParams(jsonParams, "milvus_pass").(string)
-	collection_name := getValueFromParams(jsonParams, "collection_name").(string)
-	index_name := getValueFromParams(jsonParams, "index_name").(string)
-	metric_type := getValueFromParams(jsonParams, "metric_type").(string)
-	dimstr := getValueFromParams(jsonParams, "collection_dim").(string)
-	dim, _ := strconv.ParseInt(dimstr, 10, 64)
+	collection_name := req.CollectionName
+	index_name := req.IndexName
+	metric_type := req.MetricType
+	dim := int64(req.CollectionDim)
 
 	ctx := context.Background()
-	c, err := get_milvus_client(ctx, milvus_server, milvus_port, milvus_username, milvus_pass)
+	store, err := newVectorStore(ctx, req.storeConfig())
 	if err != nil {
 		log.Println("failed to connect to milvus, err: ", err.Error())
-		gincontext.JSON(http.StatusBadRequest, gin.H{"error": "get_milvus_client failed"})
+		respondError(gincontext, codeMilvusUnavailable, "failed to connect to milvus: "+err.Error(), nil)
 		return
 	} else {
-		defer c.Close()
+		defer store.Close()
 	}
 
 	log.Printf(msgFmt, fmt.Sprintf("create collection, `%s`", collection_name))
-	schema := entity.NewSchema().WithName(collection_name).WithDescription("milvus_image_search").
-		WithField(entity.NewField().WithName("id").WithDataType(entity.FieldTypeInt64).WithIsPrimaryKey(true).WithIsAutoID(true)).
-		WithField(entity.NewField().WithName("vec").WithDataType(entity.FieldTypeFloatVector).WithDim(dim)).
-		WithField(entity.NewField().WithName("url").WithDataType(entity.FieldTypeVarChar).WithMaxLength(500))
-
-	if err := c.CreateCollection(ctx, schema, entity.DefaultShardNumber); err != nil {
-		log.Println("create collection failed, err: ", err.Error())
-		gincontext.JSON(http.StatusBadRequest, gin.H{"create collection failed, err: ": err.Error()})
+	spec := CollectionSpec{Name: collection_name, Description: "milvus_image_search", Dim: dim, MetaFields: req.metaFields()}
+	if err := store.CreateCollection(ctx, spec); err != nil {
+		respondStoreError(gincontext, "failed to create collection", err)
 		return
 	}
 
-	if index_name == "HNSW" {
-		log.Printf(msgFmt, "start creating index HNSW")
-		idx, err := entity.NewIndexHNSW(entity.MetricType(metric_type), 12, 50)
-		if err != nil {
-			log.Println("failed to create HNSW index, err: ", err.Error())
-			gincontext.JSON(http.StatusBadRequest, gin.H{"failed to create HNSW index, err:": err.Error()})
-			return
-		}
-		if err := c.CreateIndex(ctx, collection_name, "vec", idx, false); err != nil {
-			log.Println("failed to create index, err: ", err.Error())
-			gincontext.JSON(http.StatusBadRequest, gin.H{"failed to create index, err:": err.Error()})
-			return
-		}
-	} else if index_name == "IVF_FLAT" {
-		log.Printf(msgFmt, "start creating index IVF_FLAT")
-		idx, err := entity.NewIndexIvfFlat(entity.MetricType(metric_type), 12)
-		if err != nil {
-			log.Println("failed to create IVF_FLAT index, err: ", err.Error())
-			gincontext.JSON(http.StatusBadRequest, gin.H{"failed to create IVF_FLAT index, err:": err.Error()})
-			return
-		}
-		if err := c.CreateIndex(ctx, collection_name, "vec", idx, false); err != nil {
-			log.Println("failed to create index, err: ", err.Error())
-			gincontext.JSON(http.StatusBadRequest, gin.H{"failed to create index, err: ": err.Error()})
-			return
-		}
-	} else if index_name == "IVF_SQ8" {
-		log.Printf(msgFmt, "start creating index IVF_SQ8")
-		idx, err := entity.NewIndexIvfSQ8(entity.MetricType(metric_type), 12)
-		if err != nil {
-			log.Println("failed to create IVF_SQ8 index, err: ", err.Error())
-			gincontext.JSON(http.StatusBadRequest, gin.H{"failed to create IVF_SQ8 index, err: ": err.Error()})
-			return
-		}
-		if err := c.CreateIndex(ctx, collection_name, "vec", idx, false); err != nil {
-			log.Println("failed to create index, err: ", err.Error())
-			gincontext.JSON(http.StatusBadRequest, gin.H{"failed to create index, err:": err.Error()})
-			return
-		}
-	} else if index_name == "SCANN" {
-		log.Printf(msgFmt, "start creating index SCANN")
-		idx, err := entity.NewIndexSCANN(entity.MetricType(metric_type), 12, true)
-		if err != nil {
-			log.Println("failed to create SCANN index, err: ", err.Error())
-			gincontext.JSON(http.StatusBadRequest, gin.H{"failed to create SCANN index, err: ": err.Error()})
-			return
-		}
-		if err := c.CreateIndex(ctx, collection_name, "vec", idx, false); err != nil {
-			log.Println("failed to create index, err: ", err.Error())
-			gincontext.JSON(http.StatusBadRequest, gin.H{"failed to create index, err: ": err.Error()})
-			return
+	if err := store.CreateIndex(ctx, collection_name, IndexSpec{IndexType: index_name, MetricType: metric_type, Params: req.indexParams()}); err != nil {
+		// A collection without an index cannot be loaded, so do not leave it behind.
+		if dropErr := store.DropCollection(ctx, collection_name); dropErr != nil {
+			log.Println("failed to drop collection, err: ", dropErr.Error())
 		}
+		respondStoreError(gincontext, "failed to create index", err)
+		return
 	}
 
 	log.Printf(msgFmt, "start loading collection")
-	err = c.LoadCollection(ctx, collection_name, false)
+	err = store.LoadCollection(ctx, collection_name)
 	if err != nil {
-		gincontext.JSON(http.StatusBadRequest, gin.H{"failed to load collection, err: ": err.Error()})
+		respondStoreError(gincontext, "failed to load collection", err)
 		return
 	}
 
@@ -254,512 +73,436 @@ func instanceCreate(gincontext *gin.Context) {
 
 func uploadImageFiles(c *gin.Context) {
 	form, err := c.MultipartForm()
-	collectionName := c.PostForm("collectionName")
-
-	savePath := uploadServerPath + "/" + collectionName
-	err = os.MkdirAll(savePath, os.ModePerm)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建目录失败"})
+		respondError(c, codeInvalidParams, "invalid multipart form: "+err.Error(), nil)
+		return
+	}
+	collectionName := c.PostForm("collectionName")
+	if name := c.PostForm("instance"); name != "" && collectionName == "" {
+		inst, err := instances.get(name)
+		if err != nil {
+			respondInstanceError(c, err)
+			return
+		}
+		collectionName = inst.CollectionName
+	}
+	if collectionName == "" {
+		respondError(c, codeInvalidParams, "collectionName is required", []fieldError{{Field: "collectionName", Message: "is required"}})
+		return
+	}
+	savePath, ok := collectionDir(collectionName)
+	if !ok {
+		respondError(c, codeInvalidParams, "invalid collectionName: "+collectionName, []fieldError{{Field: "collectionName", Message: milvusNameMessage}})
 		return
 	}
 
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	meta, errs := uploadMeta(c.PostForm("album"), c.PostForm("source"), c.PostForm("tags"), c.PostForm("extra"), c.PostForm("meta"))
+	if len(errs) > 0 {
+		respondError(c, codeInvalidParams, "invalid upload metadata", errs)
 		return
 	}
-	files := form.File["files"]
 
-	imgFileName := ""
-	for _, file := range files {
-		imgFileName = file.Filename
-		dst := filepath.Join(savePath, file.Filename)
-		src, err := file.Open()
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "打开文件失败"})
+	// Every name is checked before anything is written, so that a bad file
+	// does not leave half of the upload behind.
+	files := form.File["files"]
+	names := make([]string, len(files))
+	for i, file := range files {
+		if names[i], err = originalName(uploadFilename(file)); err != nil {
+			respondError(c, codeInvalidParams, "invalid file name: "+uploadFilename(file), []fieldError{{Field: fmt.Sprintf("files[%d]", i), Message: "must be a plain file name"}})
 			return
 		}
-		defer src.Close()
+	}
+
+	err = os.MkdirAll(savePath, os.ModePerm)
+	if err != nil {
+		respondError(c, codeUploadFailed, "failed to create upload folder: "+err.Error(), nil)
+		return
+	}
 
-		out, err := os.Create(dst)
+	uploaded := make([]UploadedFile, 0, len(files))
+	for i, file := range files {
+		dst, err := saveUpload(file, savePath)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "创建文件失败"})
+			respondError(c, codeUploadFailed, "failed to save file: "+err.Error(), nil)
 			return
 		}
-		defer out.Close()
-
-		_, err = io.Copy(out, src)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "复制文件失败"})
+		meta[uploadNameField] = names[i]
+		if err := writeImageMeta(dst, meta); err != nil {
+			respondError(c, codeUploadFailed, "failed to save image metadata: "+err.Error(), nil)
 			return
 		}
+		uploaded = append(uploaded, UploadedFile{OriginalName: names[i], Filename: filepath.Base(dst), Url: savePath + "/" + filepath.Base(dst)})
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "Files uploaded successfully", "url": savePath + "/" + imgFileName})
+	resp := gin.H{"message": "Files uploaded successfully", "files": uploaded}
+	if len(uploaded) > 0 {
+		last := uploaded[len(uploaded)-1]
+		resp["url"], resp["filename"] = last.Url, last.Filename
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// UploadedFile is one file of an uploadImageFiles response. Filename is the
+// name the file is stored under, to be used as search_img.
+type UploadedFile struct {
+	OriginalName string `json:"original_name"`
+	Filename     string `json:"filename"`
+	Url          string `json:"url"`
 }
 
 func onPicImport(gincontext *gin.Context) {
-	var jsonParams map[string]interface{}
-	if err := gincontext.BindJSON(&jsonParams); err != nil {
-		gincontext.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format"})
+	var req ImportRequest
+	if !bindParams(gincontext, &req) {
+		return
+	}
+	collection_name := req.CollectionName
+	embed_batch_size := defaultEmbedBatchSize
+	if req.EmbedBatchSize > 0 {
+		embed_batch_size = int(req.EmbedBatchSize)
+	}
+	import_workers := defaultImportWorkers
+	if req.ImportWorkers > 0 {
+		import_workers = int(req.ImportWorkers)
+	}
+	insert_batch_size := defaultInsertBatchSize
+	if req.InsertBatchSize > 0 {
+		insert_batch_size = int(req.InsertBatchSize)
+	}
+	prune := bool(req.Prune)
+	embedder, err := req.embedder()
+	if err != nil {
+		log.Println("failed to create embedder, err: ", err.Error())
+		respondError(gincontext, codeInvalidParams, "failed to create embedder: "+err.Error(), nil)
 		return
 	}
-
-	milvus_server := getValueFromParams(jsonParams, "milvus_server").(string)
-	milvus_port := getValueFromParams(jsonParams, "milvus_port").(string)
-	milvus_username := getValueFromParams(jsonParams, "milvus_username").(string)
-	milvus_pass := getValueFromParams(jsonParams, "milvus_pass").(string)
-	collection_name := getValueFromParams(jsonParams, "collection_name").(string)
-	embed_server_url := getValueFromParams(jsonParams, "embed_server_url").(string)
-	embed_server_apikey := getValueFromParams(jsonParams, "embed_server_apikey").(string)
 
 	ctx := context.Background()
-	c, err := get_milvus_client(ctx, milvus_server, milvus_port, milvus_username, milvus_pass)
+	store, err := newVectorStore(ctx, req.storeConfig())
 	if err != nil {
 		log.Println("failed to connect to milvus, err: ", err.Error())
-		gincontext.JSON(http.StatusBadRequest, gin.H{"error": "get_milvus_client failed"})
+		respondError(gincontext, codeMilvusUnavailable, "failed to connect to milvus: "+err.Error(), nil)
 		return
-	} else {
-		defer c.Close()
 	}
+	// The store is handed over to the import job once it has started.
+	started := false
+	defer func() {
+		if !started {
+			store.Close()
+		}
+	}()
 
-	log.Printf(msgFmt, "start inserting images vectors")
+	stats, err := store.Stats(ctx, collection_name)
+	if err != nil {
+		respondStoreError(gincontext, "failed to describe collection", err)
+		return
+	}
 
-	type Row struct {
-		Vec []float32 `json:"vec" milvus:"name:vec"`
-		Url string    `json:"url" milvus:"name:url"`
+	if req.PartitionName != "" {
+		if err := checkPartition(ctx, store, collection_name, req.PartitionName); err != nil {
+			respondStoreError(gincontext, "failed to import images", err)
+			return
+		}
 	}
 
 	savePath := uploadServerPath + "/" + collection_name
 	_, err = os.Stat(savePath)
 	if err != nil {
 		log.Println("failed to load images path, err: ", err.Error())
-		gincontext.JSON(http.StatusBadRequest, gin.H{"failed to load images path, err: ": err.Error()})
+		respondError(gincontext, codeImageNotFound, "no uploaded images for collection "+collection_name, nil)
 		return
 	}
 
-	fileCount := 0
-	entries, _ := os.ReadDir(savePath)
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			fileCount++
-		}
-	}
-	rows := make([]interface{}, 0, fileCount)
-	err = filepath.Walk(savePath, func(path string, resinfo os.FileInfo, errWalk error) error {
-		if errWalk != nil {
-			log.Println("遍历文件时出错, path=%s, err: ", path, errWalk.Error())
-			return errWalk
+	key := importKey(req.storeConfig(), collection_name, req.PartitionName)
+	job, started := importJobs.start(key, collection_name, req.PartitionName, func(ctx context.Context, job *importJob) error {
+		defer store.Close()
+		total, err := countFiles(savePath)
+		if err != nil {
+			return err
 		}
-		if !resinfo.IsDir() {
-			vec, err := get_img_vec(embed_server_url, path, embed_server_apikey)
-			if err != nil {
-				log.Println("get vector error, path="+path+", err: ", err.Error())
-				return err
-			}
-			row := Row{
-				Vec: vec,
-				Url: path,
-			}
-			rows = append(rows, &row)
+		job.setTotal(total)
+		// Only the rows of the target partition count as imported, so the same
+		// images can be imported into several partitions.
+		indexed, err := store.ListFiles(ctx, collection_name, req.PartitionName)
+		if err != nil {
+			log.Println("failed to list indexed images, err: ", err.Error())
+			return err
+		}
+		if !stats.HasHash {
+			log.Printf(msgFmt, "collection "+collection_name+" has no hash field, indexed images are matched by url only")
+		}
+		if len(stats.MetaFields) == 0 {
+			log.Printf(msgFmt, "collection "+collection_name+" has no metadata fields, image metadata is not stored")
+		}
+
+		log.Printf(msgFmt, fmt.Sprintf("start inserting images vectors, job %s: %s, %d files", job.id, savePath, total))
+		result, err := runImport(ctx, store, embedder, collection_name, savePath, importOptions{
+			EmbedBatchSize:  embed_batch_size,
+			Workers:         import_workers,
+			InsertBatchSize: insert_batch_size,
+			Partition:       req.PartitionName,
+			Dim:             stats.Dim,
+			Indexed:         indexed,
+			HashFiles:       stats.HasHash,
+			Prune:           prune,
+			MetaFields:      stats.MetaFields,
+			Meta:            req.metaDefaults(),
+			OnEvent:         job.observe,
+		})
+		if err != nil {
+			log.Println("failed to import images: "+savePath+", err: ", err.Error())
+			return err
 		}
+		log.Printf(msgFmt, fmt.Sprintf("insert succeed: %s, %d images, %d skipped, %d failed, %d deleted", savePath, result.Inserted, result.Skipped, result.Failed, result.Deleted))
 		return nil
 	})
-	if err != nil {
-		gincontext.JSON(http.StatusBadRequest, gin.H{"error": "get vector error"})
-		return
-	}
-
-	_, errInsert := c.InsertRows(ctx, collection_name, "", rows)
-	if errInsert != nil {
-		log.Println("failed to insert rows: "+savePath, errInsert.Error())
-		gincontext.JSON(http.StatusBadRequest, gin.H{"failed to insert rows: ": errInsert.Error()})
+	if !started {
+		respondError(gincontext, codeImportRunning, "an import into collection "+collection_name+" is already running: job "+job.id, gin.H{"job_id": job.id})
 		return
-	} else {
-		log.Printf(msgFmt, "insert succeed: "+savePath)
 	}
-	gincontext.JSON(http.StatusOK, gin.H{"message": "insert successfully"})
+	gincontext.JSON(http.StatusAccepted, gin.H{"message": "import started", "job_id": job.id})
 }
 
+// SearchRepos is one hit of a search response. Rank starts at 1.
 type SearchRepos struct {
-	Url      string  `json:"url"`
-	Score    float32 `json:"score"`
-	Filename string  `json:"filename"`
+	ID         int64                  `json:"id"`
+	Url        string                 `json:"url"`
+	Filename   string                 `json:"filename"`
+	Score      float32                `json:"score"`
+	Rank       int                    `json:"rank"`
+	Collection string                 `json:"collection"`
+	Metadata   map[string]interface{} `json:"metadata,omitempty"`
 }
 
-func picSearchByText(gincontext *gin.Context) {
-	var jsonParams map[string]interface{}
-	if err := gincontext.BindJSON(&jsonParams); err != nil {
-		gincontext.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format"})
+// searchAndRespond searches collection_name for vec and answers with the hits,
+// the latencies and the index settings the store searched with.
+func searchAndRespond(gincontext *gin.Context, ctx context.Context, store VectorStore, req SearchParams, vec []float32, embedLatency time.Duration) {
+	collection_name := req.CollectionName
+	begin := time.Now()
+	result, err := store.Search(ctx, collection_name, SearchRequest{
+		Vector:     vec,
+		TopK:       int(req.SearchTopk),
+		IndexType:  req.IndexName,
+		MetricType: req.MetricType,
+		Tuning:     req.tuning(),
+		Filter:     req.Filter,
+		Partitions: req.PartitionNames,
+	})
+	end := time.Now()
+	if err != nil {
+		respondStoreError(gincontext, "failed to search", err)
 		return
 	}
+	resdata := make([]SearchRepos, 0, len(result.Hits))
+	for i, hit := range result.Hits {
+		resdata = append(resdata, SearchRepos{
+			ID:         hit.ID,
+			Url:        hit.Url,
+			Filename:   displayName(hit.Url, hit.Metadata),
+			Score:      hit.Score,
+			Rank:       i + 1,
+			Collection: collection_name,
+			Metadata:   hit.Metadata,
+		})
+	}
+	log.Printf("[%s] search %s: %d hits, index %s, search %dms, embed %dms", gincontext.GetString(requestIDKey), collection_name, len(result.Hits), result.IndexType, end.Sub(begin).Milliseconds(), embedLatency.Milliseconds())
+	if result.Params == nil {
+		result.Params = map[string]interface{}{}
+	}
+	gincontext.JSON(http.StatusOK, gin.H{
+		"message":          "search successfully",
+		"data":             resdata,
+		"collection":       collection_name,
+		"topk":             int(req.SearchTopk),
+		"latency_ms":       end.Sub(begin).Milliseconds(),
+		"embed_latency_ms": embedLatency.Milliseconds(),
+		"index": gin.H{
+			"index_type":  result.IndexType,
+			"metric_type": result.MetricType,
+			"params":      result.Params,
+		},
+	})
+}
 
-	milvus_server := getValueFromParams(jsonParams, "milvus_server").(string)
-	milvus_port := getValueFromParams(jsonParams, "milvus_port").(string)
-	milvus_username := getValueFromParams(jsonParams, "milvus_username").(string)
-	milvus_pass := getValueFromParams(jsonParams, "milvus_pass").(string)
-	collection_name := getValueFromParams(jsonParams, "collection_name").(string)
-	index_name := getValueFromParams(jsonParams, "index_name").(string)
-	metric_type := getValueFromParams(jsonParams, "metric_type").(string)
-	embed_server_url := getValueFromParams(jsonParams, "embed_server_url").(string)
-	embed_server_apikey := getValueFromParams(jsonParams, "embed_server_apikey").(string)
-	search_text := getValueFromParams(jsonParams, "search_text").(string)
-	search_topkstr := getValueFromParams(jsonParams, "search_topk").(string)
-	search_topk, _ := strconv.Atoi(search_topkstr)
+func picSearchByText(gincontext *gin.Context) {
+	var req SearchByTextRequest
+	if !bindParams(gincontext, &req) {
+		return
+	}
+	search_text := req.SearchText
+	embedder, err := req.embedder()
+	if err != nil {
+		log.Println("failed to create embedder, err: ", err.Error())
+		respondError(gincontext, codeInvalidParams, "failed to create embedder: "+err.Error(), nil)
+		return
+	}
 
 	ctx := context.Background()
-	c, err := get_milvus_client(ctx, milvus_server, milvus_port, milvus_username, milvus_pass)
+	store, err := newVectorStore(ctx, req.storeConfig())
 	if err != nil {
 		log.Println("failed to connect to milvus, err: ", err.Error())
-		gincontext.JSON(http.StatusBadRequest, gin.H{"error": "get_milvus_client failed"})
+		respondError(gincontext, codeMilvusUnavailable, "failed to connect to milvus: "+err.Error(), nil)
 		return
 	} else {
-		defer c.Close()
+		defer store.Close()
 	}
 
-	log.Printf(msgFmt, "start searcching based on vector similarity")
-	vecList := make([][]float32, 0, 1)
-	var vec = []float32{0}
-
-	log.Println("search by text: " + search_text + "==================")
-	vec, err = get_text_vec(embed_server_url, search_text, embed_server_apikey)
+	begin := time.Now()
+	vec, err := embedder.EmbedText(ctx, search_text)
+	embedLatency := time.Since(begin)
 	if err != nil {
 		log.Println("failed to search, err: ", err.Error())
-		gincontext.JSON(http.StatusBadRequest, gin.H{"failed to search, err: ": err.Error()})
+		respondError(gincontext, codeEmbedderFailed, "failed to embed search text: "+err.Error(), nil)
 		return
 	}
 
-	vecList = append(vecList, vec)
-	log.Println("search_vec: ==================")
-	for _, row := range vecList {
-		fmt.Print("[")
-		for i, value := range row {
-			fmt.Print(value)
-			if i != len(row)-1 {
-				fmt.Print(", ")
-			}
-		}
-		fmt.Println("]")
-	}
-	log.Println("==================")
-
-	vec2search := []entity.Vector{
-		entity.FloatVector(vecList[len(vecList)-1]),
-	}
-	var resdata []SearchRepos
-	if index_name == "HNSW" {
-		sp, _ := entity.NewIndexHNSWSearchParam(10)
-		begin := time.Now()
-		sRet, err := c.Search(ctx, collection_name, nil, "", []string{"url"}, vec2search,
-			"vec", entity.MetricType(metric_type), search_topk, sp)
-		end := time.Now()
-		if err != nil {
-			log.Println("failed to search collection, err: ", err.Error())
-			gincontext.JSON(http.StatusBadRequest, gin.H{"failed to search, err: ": err.Error()})
-			return
-		}
-		log.Println("results:")
-		fmt.Println("url\tscore")
-		for i := 0; i < search_topk; i++ {
-			for _, res := range sRet {
-				value1, _ := res.Fields.GetColumn("url").GetAsString(i)
-				fmt.Print(value1)
-				fmt.Print("\t")
-				fmt.Print(res.Scores[i])
-				fmt.Println()
-				resdata = append(resdata, SearchRepos{Url: value1, Score: res.Scores[i], Filename: filepath.Base(value1)})
-			}
-		}
-		log.Printf("\tsearch latency: %dms\n", end.Sub(begin)/time.Millisecond)
-	} else if index_name == "IVF_FLAT" {
-		sp, _ := entity.NewIndexIvfFlatSearchParam(10)
-		begin := time.Now()
-		sRet, err := c.Search(ctx, collection_name, nil, "", []string{"url"}, vec2search,
-			"vec", entity.MetricType(metric_type), search_topk, sp)
-		end := time.Now()
-		if err != nil {
-			log.Println("failed to search collection, err: ", err.Error())
-			gincontext.JSON(http.StatusBadRequest, gin.H{"failed to search, err: ": err.Error()})
-			return
-		}
-
-		log.Println("results:")
-		fmt.Println("url\tscore")
-		for i := 0; i < search_topk; i++ {
-			for _, res := range sRet {
-				value1, _ := res.Fields.GetColumn("url").GetAsString(i)
-				fmt.Print(value1)
-				fmt.Print("\t")
-				fmt.Print(res.Scores[i])
-				fmt.Println()
-				resdata = append(resdata, SearchRepos{Url: value1, Score: res.Scores[i], Filename: filepath.Base(value1)})
-			}
-		}
-		log.Printf("\tsearch latency: %dms\n", end.Sub(begin)/time.Millisecond)
-	} else if index_name == "IVF_SQ8" {
-		sp, _ := entity.NewIndexIvfSQ8SearchParam(10)
-		begin := time.Now()
-		sRet, err := c.Search(ctx, collection_name, nil, "", []string{"url"}, vec2search,
-			"vec", entity.MetricType(metric_type), search_topk, sp)
-		end := time.Now()
-		if err != nil {
-			log.Println("failed to search collection, err: ", err.Error())
-			gincontext.JSON(http.StatusBadRequest, gin.H{"failed to search, err: ": err.Error()})
-			return
-		}
-
-		log.Println("results:")
-		fmt.Println("url\tscore")
-		for i := 0; i < search_topk; i++ {
-			for _, res := range sRet {
-				value1, _ := res.Fields.GetColumn("url").GetAsString(i)
-				fmt.Print(value1)
-				fmt.Print("\t")
-				fmt.Print(res.Scores[i])
-				fmt.Println()
-				resdata = append(resdata, SearchRepos{Url: value1, Score: res.Scores[i], Filename: filepath.Base(value1)})
-			}
-		}
-		log.Printf("\tsearch latency: %dms\n", end.Sub(begin)/time.Millisecond)
-	} else if index_name == "SCANN" {
-		sp, _ := entity.NewIndexSCANNSearchParam(10, search_topk)
-		begin := time.Now()
-		sRet, err := c.Search(ctx, collection_name, nil, "", []string{"url"}, vec2search,
-			"vec", entity.MetricType(metric_type), search_topk, sp)
-		end := time.Now()
-		if err != nil {
-			log.Println("failed to search collection, err: ", err.Error())
-			gincontext.JSON(http.StatusBadRequest, gin.H{"failed to search, err: ": err.Error()})
-			return
-		}
-
-		log.Println("results:")
-		fmt.Println("url\tscore")
-		for i := 0; i < search_topk; i++ {
-			for _, res := range sRet {
-				value1, _ := res.Fields.GetColumn("url").GetAsString(i)
-				fmt.Print(value1)
-				fmt.Print("\t")
-				fmt.Print(res.Scores[i])
-				fmt.Println()
-				resdata = append(resdata, SearchRepos{Url: value1, Score: res.Scores[i], Filename: filepath.Base(value1)})
-			}
-		}
-		log.Printf("\tsearch latency: %dms\n", end.Sub(begin)/time.Millisecond)
-	}
-	resJsonData, _ := json.Marshal(resdata)
-	gincontext.JSON(http.StatusOK, gin.H{"message": "search successfully", "data": string(resJsonData)})
+	searchAndRespond(gincontext, ctx, store, req.SearchParams, vec, embedLatency)
 }
 
 func picSearchByImg(gincontext *gin.Context) {
-	var jsonParams map[string]interface{}
-	if err := gincontext.BindJSON(&jsonParams); err != nil {
-		gincontext.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format"})
+	var req SearchByImgRequest
+	if !bindParams(gincontext, &req) {
+		return
+	}
+	collection_name := req.CollectionName
+	search_img := req.SearchImg
+	// search_img is a stored file name; anything with path elements is
+	// refused before it gets near a path.
+	if name, err := originalName(search_img); err != nil || name != search_img {
+		respondError(gincontext, codeInvalidParams, "invalid search_img: "+search_img, []fieldError{{Field: "search_img", Message: "must be the name of an uploaded image"}})
+		return
+	}
+	embedder, err := req.embedder()
+	if err != nil {
+		log.Println("failed to create embedder, err: ", err.Error())
+		respondError(gincontext, codeInvalidParams, "failed to create embedder: "+err.Error(), nil)
 		return
 	}
-
-	milvus_server := getValueFromParams(jsonParams, "milvus_server").(string)
-	milvus_port := getValueFromParams(jsonParams, "milvus_port").(string)
-	milvus_username := getValueFromParams(jsonParams, "milvus_username").(string)
-	milvus_pass := getValueFromParams(jsonParams, "milvus_pass").(string)
-	collection_name := getValueFromParams(jsonParams, "collection_name").(string)
-	index_name := getValueFromParams(jsonParams, "index_name").(string)
-	metric_type := getValueFromParams(jsonParams, "metric_type").(string)
-	embed_server_url := getValueFromParams(jsonParams, "embed_server_url").(string)
-	embed_server_apikey := getValueFromParams(jsonParams, "embed_server_apikey").(string)
-	search_img := getValueFromParams(jsonParams, "search_img").(string)
-	search_topkstr := getValueFromParams(jsonParams, "search_topk").(string)
-	search_topk, _ := strconv.Atoi(search_topkstr)
 
 	ctx := context.Background()
-	c, err := get_milvus_client(ctx, milvus_server, milvus_port, milvus_username, milvus_pass)
+	store, err := newVectorStore(ctx, req.storeConfig())
 	if err != nil {
 		log.Println("failed to connect to milvus, err: ", err.Error())
-		gincontext.JSON(http.StatusBadRequest, gin.H{"error": "get_milvus_client failed"})
+		respondError(gincontext, codeMilvusUnavailable, "failed to connect to milvus: "+err.Error(), nil)
 		return
 	} else {
-		defer c.Close()
+		defer store.Close()
 	}
 
-	log.Printf(msgFmt, "start searcching based on vector similarity")
-	vecList := make([][]float32, 0, 1)
-	var vec = []float32{0}
-
-	log.Println("search by img: " + search_img + "==================")
-	vec, err = get_img_vec(embed_server_url, uploadServerPath+"/"+collection_name+"/"+search_img, embed_server_apikey)
-	if err != nil {
-		log.Println("failed to get_img_vec, err: ", err.Error())
-		gincontext.JSON(http.StatusBadRequest, gin.H{"failed to get_img_vec, err: ": err.Error()})
+	search_img_path, ok := imagePath(collection_name, uploadServerPath+"/"+collection_name+"/"+search_img)
+	if !ok {
+		respondError(gincontext, codeInvalidParams, "invalid search_img: "+search_img, []fieldError{{Field: "search_img", Message: "must be the name of an uploaded image"}})
 		return
 	}
-
-	vecList = append(vecList, vec)
-	log.Println("search_vec: ==================")
-	for _, row := range vecList {
-		fmt.Print("[")
-		for i, value := range row {
-			fmt.Print(value)
-			if i != len(row)-1 {
-				fmt.Print(", ")
-			}
-		}
-		fmt.Println("]")
+	if _, err := os.Stat(search_img_path); err != nil {
+		respondError(gincontext, codeImageNotFound, "image not found: "+search_img, nil)
+		return
 	}
-	log.Println("==================")
-
-	vec2search := []entity.Vector{
-		entity.FloatVector(vecList[len(vecList)-1]),
+	begin := time.Now()
+	vec, err := embedder.EmbedImage(ctx, search_img_path)
+	embedLatency := time.Since(begin)
+	if err != nil {
+		log.Println("failed to get_img_vec, err: ", err.Error())
+		respondError(gincontext, codeEmbedderFailed, "failed to embed search image: "+err.Error(), nil)
+		return
 	}
-	var resdata []SearchRepos
-	if index_name == "HNSW" {
-		sp, _ := entity.NewIndexHNSWSearchParam(10)
-		begin := time.Now()
-		sRet, err := c.Search(ctx, collection_name, nil, "", []string{"url"}, vec2search,
-			"vec", entity.MetricType(metric_type), search_topk, sp)
-		end := time.Now()
-		if err != nil {
-			log.Println("failed to search collection, err: ", err.Error())
-			gincontext.JSON(http.StatusBadRequest, gin.H{"failed to search, err: ": err.Error()})
-			return
-		}
-		log.Println("results:")
-		fmt.Println("url\tscore")
-		for i := 0; i < search_topk; i++ {
-			for _, res := range sRet {
-				value1, _ := res.Fields.GetColumn("url").GetAsString(i)
-				fmt.Print(value1)
-				fmt.Print("\t")
-				fmt.Print(res.Scores[i])
-				fmt.Println()
-				resdata = append(resdata, SearchRepos{Url: value1, Score: res.Scores[i], Filename: filepath.Base(value1)})
-			}
-		}
-		log.Printf("\tsearch latency: %dms\n", end.Sub(begin)/time.Millisecond)
-	} else if index_name == "IVF_FLAT" {
-		sp, _ := entity.NewIndexIvfFlatSearchParam(10)
-		begin := time.Now()
-		sRet, err := c.Search(ctx, collection_name, nil, "", []string{"url"}, vec2search,
-			"vec", entity.MetricType(metric_type), search_topk, sp)
-		end := time.Now()
-		if err != nil {
-			log.Println("failed to search collection, err: ", err.Error())
-			gincontext.JSON(http.StatusBadRequest, gin.H{"failed to search, err: ": err.Error()})
-			return
-		}
-
-		log.Println("results:")
-		fmt.Println("url\tscore")
-		for i := 0; i < search_topk; i++ {
-			for _, res := range sRet {
-				value1, _ := res.Fields.GetColumn("url").GetAsString(i)
-				fmt.Print(value1)
-				fmt.Print("\t")
-				fmt.Print(res.Scores[i])
-				fmt.Println()
-				resdata = append(resdata, SearchRepos{Url: value1, Score: res.Scores[i], Filename: filepath.Base(value1)})
-			}
-		}
-		log.Printf("\tsearch latency: %dms\n", end.Sub(begin)/time.Millisecond)
-	} else if index_name == "IVF_SQ8" {
-		sp, _ := entity.NewIndexIvfSQ8SearchParam(10)
-		begin := time.Now()
-		sRet, err := c.Search(ctx, collection_name, nil, "", []string{"url"}, vec2search,
-			"vec", entity.MetricType(metric_type), search_topk, sp)
-		end := time.Now()
-		if err != nil {
-			log.Println("failed to search collection, err: ", err.Error())
-			gincontext.JSON(http.StatusBadRequest, gin.H{"failed to search, err: ": err.Error()})
-			return
-		}
-
-		log.Println("results:")
-		fmt.Println("url\tscore")
-		for i := 0; i < search_topk; i++ {
-			for _, res := range sRet {
-				value1, _ := res.Fields.GetColumn("url").GetAsString(i)
-				fmt.Print(value1)
-				fmt.Print("\t")
-				fmt.Print(res.Scores[i])
-				fmt.Println()
-				resdata = append(resdata, SearchRepos{Url: value1, Score: res.Scores[i], Filename: filepath.Base(value1)})
-			}
-		}
-		log.Printf("\tsearch latency: %dms\n", end.Sub(begin)/time.Millisecond)
-	} else if index_name == "SCANN" {
-		sp, _ := entity.NewIndexSCANNSearchParam(10, search_topk)
-		begin := time.Now()
-		sRet, err := c.Search(ctx, collection_name, nil, "", []string{"url"}, vec2search,
-			"vec", entity.MetricType(metric_type), search_topk, sp)
-		end := time.Now()
-		if err != nil {
-			log.Println("failed to search collection, err: ", err.Error())
-			gincontext.JSON(http.StatusBadRequest, gin.H{"failed to search, err: ": err.Error()})
-			return
-		}
 
-		log.Println("results:")
-		fmt.Println("url\tscore")
-		for i := 0; i < search_topk; i++ {
-			for _, res := range sRet {
-				value1, _ := res.Fields.GetColumn("url").GetAsString(i)
-				fmt.Print(value1)
-				fmt.Print("\t")
-				fmt.Print(res.Scores[i])
-				fmt.Println()
-				resdata = append(resdata, SearchRepos{Url: value1, Score: res.Scores[i], Filename: filepath.Base(value1)})
-			}
-		}
-		log.Printf("\tsearch latency: %dms\n", end.Sub(begin)/time.Millisecond)
-	}
-	resJsonData, _ := json.Marshal(resdata)
-	gincontext.JSON(http.StatusOK, gin.H{"message": "search successfully", "data": string(resJsonData)})
+	searchAndRespond(gincontext, ctx, store, req.SearchParams, vec, embedLatency)
 }
 
 func instanceDelete(gincontext *gin.Context) {
-	var jsonParams map[string]interface{}
-	if err := gincontext.BindJSON(&jsonParams); err != nil {
-		gincontext.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format"})
+	var req InstanceDeleteRequest
+	if !bindParams(gincontext, &req) {
 		return
 	}
-
-	milvus_server := getValueFromParams(jsonParams, "milvus_server").(string)
-	milvus_port := getValueFromParams(jsonParams, "milvus_port").(string)
-	milvus_username := getValueFromParams(jsonParams, "milvus_username").(string)
-	milvus_pass := getValueFromParams(jsonParams, "milvus_pass").(string)
-	collection_name := getValueFromParams(jsonParams, "collection_name").(string)
+	collection_name := req.CollectionName
 
 	ctx := context.Background()
-	c, err := get_milvus_client(ctx, milvus_server, milvus_port, milvus_username, milvus_pass)
+	store, err := newVectorStore(ctx, req.storeConfig())
 	if err != nil {
 		log.Println("failed to connect to milvus, err: ", err.Error())
-		gincontext.JSON(http.StatusBadRequest, gin.H{"error": "get_milvus_client failed"})
+		respondError(gincontext, codeMilvusUnavailable, "failed to connect to milvus: "+err.Error(), nil)
 		return
 	} else {
-		defer c.Close()
+		defer store.Close()
 	}
 
-	has, err := c.HasCollection(ctx, collection_name)
+	has, err := store.HasCollection(ctx, collection_name)
 	if err != nil {
-		log.Println("failed to check collection exists, err: ", err.Error())
-		gincontext.JSON(http.StatusBadRequest, gin.H{"failed to check collection exists: ": err.Error()})
+		respondStoreError(gincontext, "failed to check collection exists", err)
 		return
 	}
 	if has {
-		c.DropCollection(ctx, collection_name)
-		os.RemoveAll(uploadServerPath + "/" + collection_name)
+		if err := store.DropCollection(ctx, collection_name); err != nil {
+			respondStoreError(gincontext, "failed to drop collection", err)
+			return
+		}
+		if err := os.RemoveAll(uploadServerPath + "/" + collection_name); err != nil {
+			log.Println("failed to remove images of "+collection_name+", err: ", err.Error())
+			respondError(gincontext, codeUploadFailed, "failed to remove images: "+err.Error(), nil)
+			return
+		}
 	}
 	gincontext.JSON(http.StatusOK, gin.H{"message": "success"})
 }
 
 func main() {
 	serverport := flag.String("port", "8081", "port")
+	flag.StringVar(&vectorStoreBackend, "vector_store", vectorStoreBackend, "vector store backend: milvus or local")
+	localStoreDir := flag.String("local_store_dir", filepath.Join(uploadServerPath, ".vectorstore"), "directory of the local vector store")
+	hnswM := flag.Int("hnsw_m", 12, "HNSW M of the local vector store")
+	hnswEfConstruction := flag.Int("hnsw_ef_construction", 50, "HNSW efConstruction of the local vector store")
+	hnswEf := flag.Int("hnsw_ef", 64, "HNSW search ef of the local vector store")
+	flag.IntVar(&defaultEmbedBatchSize, "embed_batch_size", defaultEmbedBatchSize, "images per embedding request during import")
+	flag.IntVar(&defaultImportWorkers, "import_workers", defaultImportWorkers, "concurrent embedding requests during import")
+	flag.IntVar(&defaultInsertBatchSize, "insert_batch_size", defaultInsertBatchSize, "rows per insert during import")
+	flag.DurationVar(&milvusIdleTimeout, "milvus_idle_timeout", milvusIdleTimeout, "close Milvus connections unused for this long")
+	flag.DurationVar(&milvusHealthInterval, "milvus_health_interval", milvusHealthInterval, "interval of Milvus connection health checks")
+	instancesFile := flag.String("instances_file", filepath.Join(uploadServerPath, ".meta", "instances.json"), "file of the instance registry")
 	flag.Parse()
+	if defaultEmbedBatchSize < 1 || defaultImportWorkers < 1 || defaultInsertBatchSize < 1 {
+		log.Fatalln("-embed_batch_size, -import_workers and -insert_batch_size must be at least 1")
+	}
+
+	var err error
+	instances, err = openInstanceRegistry(*instancesFile)
+	if err != nil {
+		log.Fatalln("failed to open instance registry, err: ", err.Error())
+	}
+
+	switch vectorStoreBackend {
+	case "milvus":
+		go milvusClients.maintain(context.Background(), milvusHealthInterval)
+	case "local":
+		local, err := openLocalStore(*localStoreDir, localStoreOptions{
+			HNSWM:              *hnswM,
+			HNSWEfConstruction: *hnswEfConstruction,
+			HNSWEf:             *hnswEf,
+		})
+		if err != nil {
+			log.Fatalln("failed to open local vector store, err: ", err.Error())
+		}
+		newVectorStore = func(ctx context.Context, cfg StoreConfig) (VectorStore, error) {
+			return local, nil
+		}
+	default:
+		log.Fatalln("unknown vector store: " + vectorStoreBackend)
+	}
 
 	gin.SetMode(gin.ReleaseMode)
-	router := gin.Default()
+	router := newRouter()
+	router.Run(":" + *serverport)
+}
+
+// newRouter returns the engine serving the API, the uploads and the web
+// pages, with the handlers bound to whatever newVectorStore returns.
+func newRouter() *gin.Engine {
+	router := gin.New()
+	router.Use(gin.LoggerWithFormatter(logFormatter), requestID(), gin.CustomRecovery(recoverPanic))
 
 	config := cors.DefaultConfig()
 	config.AllowAllOrigins = true
 	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
-	config.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization"}
+	config.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization", "X-Request-ID"}
+	config.ExposeHeaders = []string{"X-Request-ID"}
 
 	router.Use(cors.New(config))
 
@@ -769,12 +512,28 @@ func main() {
 	router.POST("/api/picSearchByText", picSearchByText)
 	router.POST("/api/picSearchByImg", picSearchByImg)
 	router.POST("/api/instanceDelete", instanceDelete)
+	router.GET("/api/instances", listInstances)
+	router.POST("/api/instances", registerInstance)
+	router.GET("/api/instances/:name", getInstance)
+	router.PUT("/api/instances/:name", updateInstance)
+	router.DELETE("/api/instances/:name", unregisterInstance)
+	router.GET("/api/collections", collectionList)
+	router.GET("/api/collections/:name/images", imageList)
+	router.DELETE("/api/collections/:name/images", imagesDelete)
+	router.DELETE("/api/collections/:name/images/:id", imageDelete)
+	router.PUT("/api/collections/:name/images/:id", imageReplace)
+	router.POST("/api/partitionCreate", partitionCreate)
+	router.POST("/api/partitionList", partitionList)
+	router.POST("/api/partitionDrop", partitionDrop)
+	router.GET("/api/jobs/:id", jobStatus)
+	router.POST("/api/jobs/:id/cancel", jobCancel)
+	router.GET("/api/jobs/:id/events", jobEvents)
 	router.GET("/api/hello", func(c *gin.Context) {
 		c.JSON(200, gin.H{
 			"message": "Hello multimodal-search!",
 		})
 	})
-	router.Static(uploadServerPath, uploadServerPath)
+	router.StaticFS(uploadServerPath, uploadsFS{gin.Dir(uploadServerPath, false)})
 
 	distFS, err := fs.Sub(staticFiles, "web/dist")
 	if err != nil {
@@ -805,7 +564,22 @@ func main() {
 		c.Status(http.StatusNotFound)
 	})
 
-	router.Run(":" + *serverport)
+	return router
+}
+
+// uploadsFS serves the uploads folder while hiding dot entries, such as the
+// local vector store directory.
+type uploadsFS struct {
+	http.FileSystem
+}
+
+func (f uploadsFS) Open(name string) (http.File, error) {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") {
+			return nil, os.ErrNotExist
+		}
+	}
+	return f.FileSystem.Open(name)
 }
 
 func isApiRequest(path string) bool {
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testDim is the dim of the fake embeddings.
+const testDim = 8
+
+// fakeEmbedding derives a vector from data, so that the same bytes always
+// embed to the same vector and different bytes almost never do.
+func fakeEmbedding(data []byte) []float32 {
+	sum := sha256.Sum256(data)
+	vec := make([]float32, testDim)
+	for i := range vec {
+		vec[i] = float32(sum[i]) - 127.5
+	}
+	return vec
+}
+
+// fakeEmbedServer speaks the legacy embedding protocol. Images embed from
+// their file content and texts from their bytes, so a text equal to the
+// content of an image finds that image.
+func fakeEmbedServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/get_img_vec", func(w http.ResponseWriter, r *http.Request) {
+		var req ParamImgInfo
+		json.NewDecoder(r.Body).Decode(&req)
+		data, err := os.ReadFile(req.Url)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(gin.H{"embedding": fakeEmbedding(data)})
+	})
+	mux.HandleFunc("/get_img_vecs", func(w http.ResponseWriter, r *http.Request) {
+		var req ParamImgsInfo
+		json.NewDecoder(r.Body).Decode(&req)
+		embeddings := make([][]float32, 0, len(req.Urls))
+		for _, url := range req.Urls {
+			data, err := os.ReadFile(url)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			embeddings = append(embeddings, fakeEmbedding(data))
+		}
+		json.NewEncoder(w).Encode(gin.H{"embeddings": embeddings})
+	})
+	mux.HandleFunc("/get_txt_vec", func(w http.ResponseWriter, r *http.Request) {
+		var req ParamTextInfo
+		json.NewDecoder(r.Body).Decode(&req)
+		json.NewEncoder(w).Encode(gin.H{"embedding": fakeEmbedding([]byte(req.Data))})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// testServer is the router running in a temporary working directory, backed
+// by a local store and the fake embedding server.
+type testServer struct {
+	t      *testing.T
+	router *gin.Engine
+	store  *localStore
+	embed  *httptest.Server
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Chdir(t.TempDir())
+	gin.SetMode(gin.TestMode)
+	store, err := openLocalStore(".vectorstore", localStoreOptions{HNSWM: 12, HNSWEfConstruction: 50, HNSWEf: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prevStore, prevInstances := newVectorStore, instances
+	newVectorStore = func(ctx context.Context, cfg StoreConfig) (VectorStore, error) {
+		return store, nil
+	}
+	if instances, err = openInstanceRegistry(filepath.Join(".meta", "instances.json")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		newVectorStore, instances = prevStore, prevInstances
+	})
+	return &testServer{t: t, router: newRouter(), store: store, embed: fakeEmbedServer(t)}
+}
+
+// params returns the connection and embedding parameters of collection.
+func (ts *testServer) params(collection string) map[string]interface{} {
+	return map[string]interface{}{
+		"milvus_server":       "localhost",
+		"milvus_port":         "19530",
+		"collection_name":     collection,
+		"embed_server_url":    ts.embed.URL,
+		"embed_server_apikey": "key",
+	}
+}
+
+// do sends a JSON request and decodes the JSON answer.
+func (ts *testServer) do(method string, path string, body interface{}) (int, map[string]interface{}) {
+	ts.t.Helper()
+	var reader *bytes.Reader
+	if body == nil {
+		reader = bytes.NewReader(nil)
+	} else {
+		data, err := json.Marshal(body)
+		if err != nil {
+			ts.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	return ts.serve(req)
+}
+
+func (ts *testServer) serve(req *http.Request) (int, map[string]interface{}) {
+	ts.t.Helper()
+	w := httptest.NewRecorder()
+	ts.router.ServeHTTP(w, req)
+	var resp map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		ts.t.Fatalf("%s %s: invalid JSON answer %q", req.Method, req.URL.Path, w.Body.String())
+	}
+	return w.Code, resp
+}
+
+// testUpload is a file of an upload request. Name is sent as is in the
+// Content-Disposition header.
+type testUpload struct {
+	Name    string
+	Content string
+}
+
+// upload posts files to /api/uploadImageFiles.
+func (ts *testServer) upload(collection string, files ...testUpload) (int, map[string]interface{}) {
+	ts.t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("collectionName", collection)
+	for _, file := range files {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", `form-data; name="files"; filename="`+file.Name+`"`)
+		header.Set("Content-Type", "application/octet-stream")
+		part, err := form.CreatePart(header)
+		if err != nil {
+			ts.t.Fatal(err)
+		}
+		part.Write([]byte(file.Content))
+	}
+	form.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/uploadImageFiles", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return ts.serve(req)
+}
+
+// createCollection creates collection through /api/instanceCreate.
+func (ts *testServer) createCollection(collection string, indexName string) {
+	ts.t.Helper()
+	params := ts.params(collection)
+	params["collection_dim"] = testDim
+	params["index_name"] = indexName
+	params["metric_type"] = "COSINE"
+	if code, resp := ts.do(http.MethodPost, "/api/instanceCreate", params); code != http.StatusOK {
+		ts.t.Fatalf("instanceCreate: %d %v", code, resp)
+	}
+}
+
+// importImages imports the uploads of collection and waits for the job.
+func (ts *testServer) importImages(collection string) map[string]interface{} {
+	ts.t.Helper()
+	code, resp := ts.do(http.MethodPost, "/api/onPicImport", ts.params(collection))
+	if code != http.StatusAccepted {
+		ts.t.Fatalf("onPicImport: %d %v", code, resp)
+	}
+	id := resp["job_id"].(string)
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		_, job := ts.do(http.MethodGet, "/api/jobs/"+id, nil)
+		if job["status"] != jobRunning {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	ts.t.Fatalf("import job %s did not finish", id)
+	return nil
+}
+
+// search runs a search by text and returns the urls of the hits.
+func (ts *testServer) search(collection string, text string, extra map[string]interface{}) []string {
+	ts.t.Helper()
+	params := ts.params(collection)
+	params["index_name"] = "HNSW"
+	params["metric_type"] = "COSINE"
+	params["search_text"] = text
+	params["search_topk"] = 3
+	for key, value := range extra {
+		params[key] = value
+	}
+	code, resp := ts.do(http.MethodPost, "/api/picSearchByText", params)
+	if code != http.StatusOK {
+		ts.t.Fatalf("picSearchByText: %d %v", code, resp)
+	}
+	var urls []string
+	for _, hit := range resp["data"].([]interface{}) {
+		urls = append(urls, hit.(map[string]interface{})["url"].(string))
+	}
+	return urls
+}
+
+func TestCreateImportSearch(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createCollection("pets", "HNSW")
+
+	code, resp := ts.upload("pets", testUpload{"cat.png", "a cat"}, testUpload{"dog.png", "a dog"}, testUpload{"fish.png", "a fish"})
+	if code != http.StatusOK {
+		t.Fatalf("upload: %d %v", code, resp)
+	}
+	urls := map[string]string{}
+	for _, file := range resp["files"].([]interface{}) {
+		file := file.(map[string]interface{})
+		urls[file["original_name"].(string)] = file["url"].(string)
+	}
+
+	job := ts.importImages("pets")
+	if job["status"] != jobSucceeded || job["inserted"] != float64(3) {
+		t.Fatalf("import: %v", job)
+	}
+	if hits := ts.search("pets", "a dog", nil); len(hits) != 3 || hits[0] != urls["dog.png"] {
+		t.Errorf("search for the dog: got %v, want %s first", hits, urls["dog.png"])
+	}
+
+	// A second import finds nothing new.
+	if job := ts.importImages("pets"); job["inserted"] != float64(0) || job["skipped"] != float64(3) {
+		t.Errorf("second import: %v", job)
+	}
+	if stats, _ := ts.store.Stats(context.Background(), "pets"); stats.RowCount != 3 {
+		t.Errorf("rows after the second import: got %d, want 3", stats.RowCount)
+	}
+}
+
+func TestSearchFilter(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createCollection("pets", "FLAT")
+	code, resp := ts.upload("pets", testUpload{"cat.png", "a cat"}, testUpload{"dog.png", "a dog"})
+	if code != http.StatusOK {
+		t.Fatalf("upload: %d %v", code, resp)
+	}
+	ts.importImages("pets")
+
+	cat := resp["files"].([]interface{})[0].(map[string]interface{})["url"].(string)
+	hits := ts.search("pets", "a dog", map[string]interface{}{"filter": `url == "` + cat + `"`})
+	if len(hits) != 1 || hits[0] != cat {
+		t.Errorf("filtered search: got %v, want the cat only", hits)
+	}
+
+	params := ts.params("pets")
+	params["index_name"], params["metric_type"], params["search_topk"] = "FLAT", "COSINE", 3
+	params["search_text"], params["filter"] = "a dog", "nope == 1"
+	if code, resp := ts.do(http.MethodPost, "/api/picSearchByText", params); code != http.StatusBadRequest || resp["code"] != codeInvalidFilter {
+		t.Errorf("search with an unknown field: %d %v", code, resp)
+	}
+}
+
+func TestSearchMissingCollection(t *testing.T) {
+	ts := newTestServer(t)
+	params := ts.params("missing")
+	params["index_name"], params["metric_type"], params["search_topk"] = "HNSW", "COSINE", 3
+	params["search_text"] = "a dog"
+	if code, resp := ts.do(http.MethodPost, "/api/picSearchByText", params); code != http.StatusNotFound || resp["code"] != codeCollectionNotFound {
+		t.Errorf("search in a missing collection: %d %v", code, resp)
+	}
+}
+
+func TestInstanceCreateInvalidParams(t *testing.T) {
+	ts := newTestServer(t)
+	params := ts.params("pets")
+	params["collection_dim"] = 0
+	params["index_name"] = "NOPE"
+	params["metric_type"] = "COSINE"
+	code, resp := ts.do(http.MethodPost, "/api/instanceCreate", params)
+	if code != http.StatusBadRequest || resp["code"] != codeInvalidParams {
+		t.Fatalf("instanceCreate: %d %v", code, resp)
+	}
+	fields := map[string]bool{}
+	for _, detail := range resp["details"].([]interface{}) {
+		fields[detail.(map[string]interface{})["field"].(string)] = true
+	}
+	if !fields["collection_dim"] || !fields["index_name"] {
+		t.Errorf("details: got %v, want collection_dim and index_name", resp["details"])
+	}
+	if has, _ := ts.store.HasCollection(context.Background(), "pets"); has {
+		t.Error("collection created despite invalid params")
+	}
+}
+
+func TestInstanceDelete(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createCollection("pets", "FLAT")
+	if code, resp := ts.upload("pets", testUpload{"cat.png", "a cat"}); code != http.StatusOK {
+		t.Fatalf("upload: %d %v", code, resp)
+	}
+	if code, resp := ts.do(http.MethodPost, "/api/instanceDelete", ts.params("pets")); code != http.StatusOK {
+		t.Fatalf("instanceDelete: %d %v", code, resp)
+	}
+	if has, _ := ts.store.HasCollection(context.Background(), "pets"); has {
+		t.Error("collection left after instanceDelete")
+	}
+	if _, err := os.Stat(uploadServerPath + "/pets"); !os.IsNotExist(err) {
+		t.Errorf("images left after instanceDelete: %v", err)
+	}
+}
+
+func TestImportBatches(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createCollection("pets", "FLAT")
+	var files []testUpload
+	for i := 0; i < 7; i++ {
+		files = append(files, testUpload{fmt.Sprintf("pet%d.png", i), fmt.Sprintf("pet %d", i)})
+	}
+	code, resp := ts.upload("pets", files...)
+	if code != http.StatusOK {
+		t.Fatalf("upload: %d %v", code, resp)
+	}
+	pet5 := resp["files"].([]interface{})[5].(map[string]interface{})["url"].(string)
+
+	// The defaults of the batch parameters come from the flags.
+	prev := [3]int{defaultEmbedBatchSize, defaultImportWorkers, defaultInsertBatchSize}
+	defaultEmbedBatchSize, defaultImportWorkers, defaultInsertBatchSize = 2, 3, 2
+	t.Cleanup(func() {
+		defaultEmbedBatchSize, defaultImportWorkers, defaultInsertBatchSize = prev[0], prev[1], prev[2]
+	})
+	if job := ts.importImages("pets"); job["status"] != jobSucceeded || job["inserted"] != float64(7) {
+		t.Fatalf("import job: %v", job)
+	}
+	if stats, _ := ts.store.Stats(context.Background(), "pets"); stats.RowCount != 7 {
+		t.Errorf("rows after the import: got %d, want 7", stats.RowCount)
+	}
+	if hits := ts.search("pets", "pet 5", nil); len(hits) == 0 || hits[0] != pet5 {
+		t.Errorf("search for pet 5: got %v, want %s first", hits, pet5)
+	}
+
+	params := ts.params("pets")
+	params["import_workers"] = -1
+	if code, _ := ts.do(http.MethodPost, "/api/onPicImport", params); code != http.StatusBadRequest {
+		t.Errorf("onPicImport with -1 workers: got %d, want 400", code)
+	}
+}
+
+func TestQueryCredentials(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createCollection("pets", "FLAT")
+	for _, path := range []string{"/api/collections", "/api/collections/pets/images"} {
+		code, resp := ts.do(http.MethodGet, path+"?milvus_server=localhost&milvus_port=19530&milvus_pass=secret", nil)
+		if code != http.StatusBadRequest || resp["code"] != codeInvalidParams {
+			t.Errorf("GET %s with milvus_pass: %d %v", path, code, resp)
+		}
+		if code, resp := ts.do(http.MethodGet, path+"?milvus_server=localhost&milvus_port=19530", nil); code != http.StatusOK {
+			t.Errorf("GET %s: %d %v", path, code, resp)
+		}
+	}
+	got := redactQuery("/api/collections?milvus_pass=secret&milvus_server=localhost")
+	if strings.Contains(got, "secret") || !strings.Contains(got, "milvus_server=localhost") {
+		t.Errorf("logged path: got %s", got)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// partitionNamePattern is the partition naming rule of Milvus.
+var partitionNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,254}$`)
+
+// checkPartition returns errPartitionNotFound unless collection has
+// partition.
+func checkPartition(ctx context.Context, store VectorStore, collection string, partition string) error {
+	partitions, err := store.ListPartitions(ctx, collection)
+	if err != nil {
+		return err
+	}
+	for _, p := range partitions {
+		if p.Name == partition {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s.%s", errPartitionNotFound, collection, partition)
+}
+
+func partitionCreate(gincontext *gin.Context) {
+	var req PartitionRequest
+	if !bindParams(gincontext, &req) {
+		return
+	}
+	ctx := context.Background()
+	store, err := newVectorStore(ctx, req.storeConfig())
+	if err != nil {
+		log.Println("failed to connect to milvus, err: ", err.Error())
+		respondError(gincontext, codeMilvusUnavailable, "failed to connect to milvus: "+err.Error(), nil)
+		return
+	}
+	defer store.Close()
+
+	log.Printf(msgFmt, fmt.Sprintf("create partition, `%s.%s`", req.CollectionName, req.PartitionName))
+	if err := store.CreatePartition(ctx, req.CollectionName, req.PartitionName); err != nil {
+		respondStoreError(gincontext, "failed to create partition", err)
+		return
+	}
+	gincontext.JSON(http.StatusOK, gin.H{"message": "success"})
+}
+
+// PartitionInfoResponse is one partition of a partitionList response.
+type PartitionInfoResponse struct {
+	Name     string `json:"name"`
+	RowCount int64  `json:"row_count"`
+}
+
+func partitionList(gincontext *gin.Context) {
+	var req PartitionListRequest
+	if !bindParams(gincontext, &req) {
+		return
+	}
+	ctx := context.Background()
+	store, err := newVectorStore(ctx, req.storeConfig())
+	if err != nil {
+		log.Println("failed to connect to milvus, err: ", err.Error())
+		respondError(gincontext, codeMilvusUnavailable, "failed to connect to milvus: "+err.Error(), nil)
+		return
+	}
+	defer store.Close()
+
+	partitions, err := store.ListPartitions(ctx, req.CollectionName)
+	if err != nil {
+		respondStoreError(gincontext, "failed to list partitions", err)
+		return
+	}
+	data := make([]PartitionInfoResponse, 0, len(partitions))
+	for _, p := range partitions {
+		data = append(data, PartitionInfoResponse{Name: p.Name, RowCount: p.RowCount})
+	}
+	gincontext.JSON(http.StatusOK, gin.H{"message": "success", "collection": req.CollectionName, "data": data})
+}
+
+func partitionDrop(gincontext *gin.Context) {
+	var req PartitionRequest
+	if !bindParams(gincontext, &req) {
+		return
+	}
+	ctx := context.Background()
+	store, err := newVectorStore(ctx, req.storeConfig())
+	if err != nil {
+		log.Println("failed to connect to milvus, err: ", err.Error())
+		respondError(gincontext, codeMilvusUnavailable, "failed to connect to milvus: "+err.Error(), nil)
+		return
+	}
+	defer store.Close()
+
+	log.Printf(msgFmt, fmt.Sprintf("drop partition, `%s.%s`", req.CollectionName, req.PartitionName))
+	if err := store.DropPartition(ctx, req.CollectionName, req.PartitionName); err != nil {
+		respondStoreError(gincontext, "failed to drop partition", err)
+		return
+	}
+	gincontext.JSON(http.StatusOK, gin.H{"message": "success"})
+}
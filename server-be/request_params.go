@@ -0,0 +1,726 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// vectorStoreBackend is the -vector_store flag. The Milvus connection
+// parameters are only required when it is "milvus".
+var vectorStoreBackend = "milvus"
+
+// flexString is a string parameter that also accepts a JSON number, since
+// clients send ports both ways.
+type flexString string
+
+func (s *flexString) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch value := value.(type) {
+	case nil:
+		*s = ""
+	case string:
+		*s = flexString(value)
+	case float64:
+		*s = flexString(strconv.FormatFloat(value, 'f', -1, 64))
+	default:
+		return errors.New("not a string")
+	}
+	return nil
+}
+
+// flexInt is an integer parameter that also accepts a numeric string. An
+// empty string counts as missing.
+type flexInt int
+
+func (n *flexInt) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch value := value.(type) {
+	case nil:
+		*n = 0
+	case float64:
+		if value != float64(int(value)) {
+			return errors.New("not an integer")
+		}
+		*n = flexInt(value)
+	case string:
+		if strings.TrimSpace(value) == "" {
+			*n = 0
+			return nil
+		}
+		i, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return err
+		}
+		*n = flexInt(i)
+	default:
+		return errors.New("not an integer")
+	}
+	return nil
+}
+
+// flexBool is a boolean parameter that also accepts "true" and "false".
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch value := value.(type) {
+	case nil:
+		*b = false
+	case bool:
+		*b = flexBool(value)
+	case string:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*b = flexBool(parsed)
+	default:
+		return errors.New("not a boolean")
+	}
+	return nil
+}
+
+// flexStrings is a list parameter that also accepts a comma separated string.
+type flexStrings []string
+
+func (l *flexStrings) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch value := value.(type) {
+	case nil:
+		*l = nil
+	case string:
+		*l = splitTags(value)
+	case []interface{}:
+		list := make([]string, 0, len(value))
+		for _, item := range value {
+			s, ok := item.(string)
+			if !ok {
+				return errors.New("not a list of strings")
+			}
+			list = append(list, s)
+		}
+		*l = list
+	default:
+		return errors.New("not a list of strings")
+	}
+	return nil
+}
+
+// flexFloat is an optional number parameter that also accepts a numeric
+// string. Unlike flexInt it tells zero from missing, since 0 is a valid
+// search radius.
+type flexFloat struct {
+	value float64
+	set   bool
+}
+
+func (f *flexFloat) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch value := value.(type) {
+	case nil:
+		*f = flexFloat{}
+	case float64:
+		*f = flexFloat{value: value, set: true}
+	case string:
+		if strings.TrimSpace(value) == "" {
+			*f = flexFloat{}
+			return nil
+		}
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return err
+		}
+		*f = flexFloat{value: parsed, set: true}
+	default:
+		return errors.New("not a number")
+	}
+	return nil
+}
+
+// ptr returns the value of f, or nil when it was not given.
+func (f flexFloat) ptr() *float64 {
+	if !f.set {
+		return nil
+	}
+	value := f.value
+	return &value
+}
+
+// StoreParams are the Milvus connection parameters of a request.
+type StoreParams struct {
+	MilvusServer   string     `json:"milvus_server"`
+	MilvusPort     flexString `json:"milvus_port"`
+	MilvusUsername string     `json:"milvus_username"`
+	MilvusPass     string     `json:"milvus_pass"`
+}
+
+func (p StoreParams) storeConfig() StoreConfig {
+	return StoreConfig{MilvusServer: p.MilvusServer, MilvusPort: string(p.MilvusPort), MilvusUsername: p.MilvusUsername, MilvusPass: p.MilvusPass}
+}
+
+func (p StoreParams) check() []fieldError {
+	if vectorStoreBackend != "milvus" {
+		return nil
+	}
+	var errs []fieldError
+	if p.MilvusServer == "" {
+		errs = append(errs, fieldError{Field: "milvus_server", Message: "is required"})
+	}
+	if p.MilvusPort == "" {
+		errs = append(errs, fieldError{Field: "milvus_port", Message: "is required"})
+	}
+	return errs
+}
+
+// EmbedParams select the embedding service of a request.
+type EmbedParams struct {
+	EmbedProvider      string `json:"embed_provider" binding:"omitempty,oneof=legacy openai template"`
+	EmbedServerUrl     string `json:"embed_server_url" binding:"required"`
+	EmbedServerApikey  string `json:"embed_server_apikey"`
+	EmbedModel         string `json:"embed_model"`
+	EmbedTextTemplate  string `json:"embed_text_template"`
+	EmbedImageTemplate string `json:"embed_image_template"`
+	EmbedResponsePath  string `json:"embed_response_path"`
+}
+
+func (p EmbedParams) embedder() (Embedder, error) {
+	return newEmbedder(EmbedderConfig{
+		Provider:      p.EmbedProvider,
+		Url:           p.EmbedServerUrl,
+		ApiKey:        p.EmbedServerApikey,
+		Model:         p.EmbedModel,
+		TextTemplate:  p.EmbedTextTemplate,
+		ImageTemplate: p.EmbedImageTemplate,
+		ResponsePath:  p.EmbedResponsePath,
+	})
+}
+
+// InstanceCreateRequest is the body of /api/instanceCreate. The build
+// parameters must apply to the index type; zero ones take the defaults.
+type InstanceCreateRequest struct {
+	StoreParams
+	CollectionName      string  `json:"collection_name" binding:"required,collection_name"`
+	CollectionDim       flexInt `json:"collection_dim" binding:"required,min=1,max=32768"`
+	IndexName           string  `json:"index_name" binding:"required,index_type"`
+	MetricType          string  `json:"metric_type" binding:"required,oneof=L2 IP COSINE"`
+	IndexM              flexInt `json:"index_m" binding:"omitempty,min=2,max=2048"`
+	IndexEfConstruction flexInt `json:"index_ef_construction" binding:"omitempty,min=1,max=65536"`
+	IndexNlist          flexInt `json:"index_nlist" binding:"omitempty,min=1,max=65536"`
+	IndexPQM            flexInt `json:"index_pq_m" binding:"omitempty,min=1"`
+	IndexNbits          flexInt `json:"index_nbits" binding:"omitempty,min=1,max=16"`
+	// Metadata fields of the collection besides imageMetaFields.
+	SchemaFields []MetaField `json:"schema_fields"`
+}
+
+// metaFields returns the metadata fields of the new collection.
+func (r InstanceCreateRequest) metaFields() []MetaField {
+	fields := slices.Clone(imageMetaFields)
+	for _, field := range r.SchemaFields {
+		fields = append(fields, field.withLimits())
+	}
+	return fields
+}
+
+func (r InstanceCreateRequest) indexParams() IndexParams {
+	p := IndexParams{
+		M:              int(r.IndexM),
+		EfConstruction: int(r.IndexEfConstruction),
+		Nlist:          int(r.IndexNlist),
+		PQM:            int(r.IndexPQM),
+		Nbits:          int(r.IndexNbits),
+	}
+	if r.IndexName == "IVF_PQ" && p.PQM == 0 {
+		p.PQM = defaultPQM(int(r.CollectionDim))
+	}
+	return p
+}
+
+func (r InstanceCreateRequest) check() []fieldError {
+	errs := r.StoreParams.check()
+	errs = append(errs, checkSchemaFields("schema_fields", r.SchemaFields)...)
+	it, err := lookupIndexType(r.IndexName)
+	if err != nil {
+		return errs
+	}
+	var given []string
+	if r.IndexM != 0 {
+		given = append(given, "index_m")
+	}
+	if r.IndexEfConstruction != 0 {
+		given = append(given, "index_ef_construction")
+	}
+	if r.IndexNlist != 0 {
+		given = append(given, "index_nlist")
+	}
+	if r.IndexPQM != 0 {
+		given = append(given, "index_pq_m")
+	}
+	if r.IndexNbits != 0 {
+		given = append(given, "index_nbits")
+	}
+	unsupported := it.unsupported(given, it.buildParams)
+	errs = append(errs, unsupported...)
+	if len(unsupported) == 0 && r.IndexPQM != 0 && r.CollectionDim != 0 && r.CollectionDim%r.IndexPQM != 0 {
+		errs = append(errs, fieldError{Field: "index_pq_m", Message: "must divide collection_dim"})
+	}
+	return errs
+}
+
+// InstanceDeleteRequest is the body of /api/instanceDelete.
+type InstanceDeleteRequest struct {
+	StoreParams
+	CollectionName string `json:"collection_name" binding:"required,collection_name"`
+}
+
+// CollectionListRequest is the query of GET /api/collections.
+type CollectionListRequest struct {
+	StoreParams
+}
+
+// PartitionListRequest is the body of /api/partitionList.
+type PartitionListRequest struct {
+	StoreParams
+	CollectionName string `json:"collection_name" binding:"required,collection_name"`
+}
+
+// PartitionRequest is the body of /api/partitionCreate and
+// /api/partitionDrop.
+type PartitionRequest struct {
+	StoreParams
+	CollectionName string `json:"collection_name" binding:"required,collection_name"`
+	PartitionName  string `json:"partition_name" binding:"required,partition_name"`
+}
+
+// ImageDeleteRequest is the body of DELETE /api/collections/:name/images/:id.
+type ImageDeleteRequest struct {
+	StoreParams
+	CollectionName string  `json:"collection_name" binding:"required,collection_name"`
+	ID             flexInt `json:"id" binding:"required"`
+}
+
+// defaultImageListLimit is the page size of GET /api/collections/:name/images
+// without a limit.
+const defaultImageListLimit = 20
+
+// ImageListRequest is the query of GET /api/collections/:name/images.
+type ImageListRequest struct {
+	StoreParams
+	CollectionName string  `json:"collection_name" binding:"required,collection_name"`
+	Offset         flexInt `json:"offset" binding:"omitempty,min=0"`
+	Limit          flexInt `json:"limit" binding:"omitempty,min=1,max=1000"`
+	Filter         string  `json:"filter" binding:"max=65536"`
+}
+
+func (r ImageListRequest) check() []fieldError {
+	if int(r.Offset)+r.limit() > maxQueryWindow {
+		return []fieldError{{Field: "offset", Message: fmt.Sprintf("plus limit must be at most %d, narrow the filter instead", maxQueryWindow)}}
+	}
+	return nil
+}
+
+// limit returns the page size, defaultImageListLimit unless Limit is set.
+func (r ImageListRequest) limit() int {
+	if r.Limit == 0 {
+		return defaultImageListLimit
+	}
+	return int(r.Limit)
+}
+
+// ImagesDeleteRequest is the body of DELETE /api/collections/:name/images.
+// Exactly one of Urls, Hashes and Filter selects the images.
+type ImagesDeleteRequest struct {
+	StoreParams
+	CollectionName string      `json:"collection_name" binding:"required,collection_name"`
+	Urls           flexStrings `json:"urls" binding:"max=10000"`
+	Hashes         flexStrings `json:"hashes" binding:"max=10000"`
+	Filter         string      `json:"filter" binding:"max=65536"`
+}
+
+func (r ImagesDeleteRequest) check() []fieldError {
+	given := 0
+	for _, set := range []bool{len(r.Urls) > 0, len(r.Hashes) > 0, strings.TrimSpace(r.Filter) != ""} {
+		if set {
+			given++
+		}
+	}
+	if given != 1 {
+		return []fieldError{{Field: "", Message: "exactly one of urls, hashes and filter is required"}}
+	}
+	return nil
+}
+
+// filter returns the filter selecting the images to delete.
+func (r ImagesDeleteRequest) filter() string {
+	switch {
+	case len(r.Urls) > 0:
+		return filterIn("url", r.Urls)
+	case len(r.Hashes) > 0:
+		return filterIn("hash", r.Hashes)
+	}
+	return r.Filter
+}
+
+// ImageReplaceRequest is the form of PUT /api/collections/:name/images/:id,
+// next to the new image file. The metadata fields are those of
+// /api/uploadImageFiles; when none is given the image keeps its metadata.
+type ImageReplaceRequest struct {
+	StoreParams
+	EmbedParams
+	CollectionName string  `json:"collection_name" binding:"required,collection_name"`
+	ID             flexInt `json:"id" binding:"required"`
+	Album          string  `json:"album"`
+	Tags           string  `json:"tags"`
+	Source         string  `json:"source"`
+	Extra          string  `json:"extra"`
+	Meta           string  `json:"meta"`
+}
+
+// ImportRequest is the body of /api/onPicImport. Zero sizes take the server
+// defaults, and an empty partition the default partition.
+type ImportRequest struct {
+	StoreParams
+	EmbedParams
+	CollectionName  string   `json:"collection_name" binding:"required,collection_name"`
+	PartitionName   string   `json:"partition_name" binding:"omitempty,partition_name"`
+	EmbedBatchSize  flexInt  `json:"embed_batch_size" binding:"omitempty,min=1,max=1024"`
+	ImportWorkers   flexInt  `json:"import_workers" binding:"omitempty,min=1,max=64"`
+	InsertBatchSize flexInt  `json:"insert_batch_size" binding:"omitempty,min=1,max=100000"`
+	Prune           flexBool `json:"prune"`
+	// Metadata for the images that were not given any at upload.
+	Album  string                 `json:"album"`
+	Tags   flexStrings            `json:"tags"`
+	Source string                 `json:"source"`
+	Extra  map[string]interface{} `json:"extra"`
+	// Values of the fields declared at collection creation.
+	Meta map[string]interface{} `json:"meta"`
+}
+
+// metaDefaults returns the metadata given in the request.
+func (r ImportRequest) metaDefaults() map[string]interface{} {
+	meta := map[string]interface{}{}
+	for key, value := range r.Meta {
+		meta[key] = value
+	}
+	if r.Album != "" {
+		meta["album"] = r.Album
+	}
+	if len(r.Tags) > 0 {
+		meta["tags"] = []string(r.Tags)
+	}
+	if r.Source != "" {
+		meta["source"] = r.Source
+	}
+	if len(r.Extra) > 0 {
+		meta["extra"] = r.Extra
+	}
+	return meta
+}
+
+// SearchParams are shared by the search requests. The tuning parameters must
+// apply to the index type; zero ones take the defaults.
+type SearchParams struct {
+	StoreParams
+	EmbedParams
+	CollectionName    string    `json:"collection_name" binding:"required,collection_name"`
+	IndexName         string    `json:"index_name" binding:"required,index_type"`
+	MetricType        string    `json:"metric_type" binding:"required,oneof=L2 IP COSINE"`
+	SearchTopk        flexInt   `json:"search_topk" binding:"required,min=1,max=16384"`
+	SearchEf          flexInt   `json:"search_ef" binding:"omitempty,min=1,max=32768"`
+	SearchNprobe      flexInt   `json:"search_nprobe" binding:"omitempty,min=1,max=65536"`
+	SearchReorderK    flexInt   `json:"search_reorder_k" binding:"omitempty,min=1"`
+	SearchRadius      flexFloat `json:"search_radius"`
+	SearchRangeFilter flexFloat `json:"search_range_filter"`
+	Filter            string    `json:"filter" binding:"max=65536"`
+	// PartitionNames restricts the search to these partitions.
+	PartitionNames flexStrings `json:"partition_names" binding:"omitempty,max=1024,dive,partition_name"`
+}
+
+func (p SearchParams) tuning() SearchTuning {
+	return SearchTuning{
+		Ef:          int(p.SearchEf),
+		Nprobe:      int(p.SearchNprobe),
+		ReorderK:    int(p.SearchReorderK),
+		Radius:      p.SearchRadius.ptr(),
+		RangeFilter: p.SearchRangeFilter.ptr(),
+	}
+}
+
+func (p SearchParams) check() []fieldError {
+	errs := p.StoreParams.check()
+	if p.SearchRangeFilter.set {
+		switch {
+		case !p.SearchRadius.set:
+			errs = append(errs, fieldError{Field: "search_range_filter", Message: "requires search_radius"})
+		case p.MetricType == "L2" && p.SearchRangeFilter.value >= p.SearchRadius.value:
+			errs = append(errs, fieldError{Field: "search_range_filter", Message: "must be less than search_radius for L2"})
+		case p.MetricType != "L2" && p.SearchRangeFilter.value <= p.SearchRadius.value:
+			errs = append(errs, fieldError{Field: "search_range_filter", Message: "must be greater than search_radius for " + p.MetricType})
+		}
+	}
+
+	it, err := lookupIndexType(p.IndexName)
+	if err != nil {
+		return errs
+	}
+	var given []string
+	if p.SearchEf != 0 {
+		given = append(given, "search_ef")
+	}
+	if p.SearchNprobe != 0 {
+		given = append(given, "search_nprobe")
+	}
+	if p.SearchReorderK != 0 {
+		given = append(given, "search_reorder_k")
+	}
+	unsupported := it.unsupported(given, it.searchParams)
+	errs = append(errs, unsupported...)
+	if len(unsupported) > 0 {
+		return errs
+	}
+	// Milvus needs the candidate lists to hold at least topk hits.
+	if p.SearchEf != 0 && p.SearchEf < p.SearchTopk {
+		errs = append(errs, fieldError{Field: "search_ef", Message: "must be at least search_topk"})
+	}
+	if p.SearchReorderK != 0 && p.SearchReorderK < p.SearchTopk {
+		errs = append(errs, fieldError{Field: "search_reorder_k", Message: "must be at least search_topk"})
+	}
+	return errs
+}
+
+// SearchByTextRequest is the body of /api/picSearchByText.
+type SearchByTextRequest struct {
+	SearchParams
+	SearchText string `json:"search_text" binding:"required"`
+}
+
+// SearchByImgRequest is the body of /api/picSearchByImg. SearchImg is the
+// name of an image uploaded to the collection.
+type SearchByImgRequest struct {
+	SearchParams
+	SearchImg string `json:"search_img" binding:"required"`
+}
+
+// fieldError is one invalid parameter of a request.
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func init() {
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(jsonFieldName)
+		v.RegisterValidation("index_type", func(fl validator.FieldLevel) bool {
+			_, err := lookupIndexType(fl.Field().String())
+			return err == nil
+		})
+		v.RegisterValidation("partition_name", func(fl validator.FieldLevel) bool {
+			return partitionNamePattern.MatchString(fl.Field().String())
+		})
+		v.RegisterValidation("collection_name", func(fl validator.FieldLevel) bool {
+			return collectionNamePattern.MatchString(fl.Field().String())
+		})
+	}
+}
+
+func jsonFieldName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+// bindParams decodes the JSON body of a request into req, after filling in
+// the parameters of the instance it names, and validates it. When a parameter
+// is invalid it responds with INVALID_PARAMS, listing every invalid parameter
+// in the details, and returns false.
+func bindParams(gincontext *gin.Context, req interface{}) bool {
+	return bindRouteParams(gincontext, req, nil)
+}
+
+// bindRouteParams is bindParams for routes with path parameters, such as the
+// collection name. route maps parameter names to their path values, which
+// win over the body and the instance. An empty body counts as no parameters,
+// and parameters missing from the body are also looked up in the query
+// string, for GET requests. Credentials are refused there; GET requests
+// get them from their instance.
+func bindRouteParams(gincontext *gin.Context, req interface{}, route map[string]string) bool {
+	var params map[string]interface{}
+	if gincontext.Request.ContentLength != 0 {
+		if err := gincontext.ShouldBindJSON(&params); err != nil {
+			respondError(gincontext, codeInvalidJSON, "Invalid JSON format", nil)
+			return false
+		}
+	}
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	for key, values := range gincontext.Request.URL.Query() {
+		// URLs end up in access logs and browser histories.
+		if _, ok := instanceSecrets[key]; ok {
+			respondError(gincontext, codeInvalidParams, "invalid request", []fieldError{{Field: key, Message: "must not be sent in the query string, use instance"}})
+			return false
+		}
+		if _, ok := params[key]; !ok && len(values) > 0 {
+			params[key] = values[0]
+		}
+	}
+	return bindParamMap(gincontext, req, params, route)
+}
+
+// bindFormParams is bindRouteParams for multipart requests, taking the
+// parameters from the form values.
+func bindFormParams(gincontext *gin.Context, req interface{}, route map[string]string) bool {
+	form, err := gincontext.MultipartForm()
+	if err != nil {
+		respondError(gincontext, codeInvalidParams, "invalid multipart form: "+err.Error(), nil)
+		return false
+	}
+	params := map[string]interface{}{}
+	for key, values := range form.Value {
+		if len(values) > 0 {
+			params[key] = values[0]
+		}
+	}
+	return bindParamMap(gincontext, req, params, route)
+}
+
+func bindParamMap(gincontext *gin.Context, req interface{}, params map[string]interface{}, route map[string]string) bool {
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	if err := applyInstance(params); err != nil {
+		respondInstanceError(gincontext, err)
+		return false
+	}
+	for key, value := range route {
+		params[key] = value
+	}
+
+	errs := decodeParams(params, reflect.ValueOf(req).Elem())
+	errs = append(errs, validateParams(req, errs)...)
+	if len(errs) > 0 {
+		respondError(gincontext, codeInvalidParams, "invalid request", errs)
+		return false
+	}
+	return true
+}
+
+// decodeParams sets each field of dst from params one by one, so that every
+// parameter of the wrong type is reported rather than only the first one.
+func decodeParams(params map[string]interface{}, dst reflect.Value) []fieldError {
+	var errs []fieldError
+	for i := 0; i < dst.NumField(); i++ {
+		field := dst.Type().Field(i)
+		if field.Anonymous {
+			errs = append(errs, decodeParams(params, dst.Field(i))...)
+			continue
+		}
+		name := jsonFieldName(field)
+		value, ok := params[name]
+		if name == "" || !ok {
+			continue
+		}
+		data, _ := json.Marshal(value)
+		if err := json.Unmarshal(data, dst.Field(i).Addr().Interface()); err != nil {
+			errs = append(errs, fieldError{Field: name, Message: typeMessage(field.Type)})
+		}
+	}
+	return errs
+}
+
+func typeMessage(t reflect.Type) string {
+	if t == reflect.TypeOf(flexFloat{}) {
+		return "must be a number"
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int64:
+		return "must be an integer"
+	case reflect.Bool:
+		return "must be a boolean"
+	case reflect.String:
+		return "must be a string"
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Struct {
+			return "must be a list of objects with fields of the right types"
+		}
+		return "must be a list of strings"
+	case reflect.Map:
+		return "must be an object"
+	}
+	return "has an invalid type"
+}
+
+// validateParams runs the binding rules of req and its check method, if any,
+// skipping the fields already reported in decoded.
+func validateParams(req interface{}, decoded []fieldError) []fieldError {
+	reported := map[string]bool{}
+	for _, e := range decoded {
+		reported[e.Field] = true
+	}
+	var errs []fieldError
+	add := func(e fieldError) {
+		if !reported[e.Field] {
+			reported[e.Field] = true
+			errs = append(errs, e)
+		}
+	}
+
+	if checker, ok := req.(interface{ check() []fieldError }); ok {
+		for _, e := range checker.check() {
+			add(e)
+		}
+	}
+	err := binding.Validator.ValidateStruct(req)
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		for _, e := range validationErrs {
+			add(fieldError{Field: e.Field(), Message: ruleMessage(e)})
+		}
+	} else if err != nil {
+		add(fieldError{Field: "", Message: err.Error()})
+	}
+	return errs
+}
+
+func ruleMessage(e validator.FieldError) string {
+	switch e.Tag() {
+	case "required":
+		return "is required"
+	case "min":
+		return "must be at least " + e.Param()
+	case "max":
+		return "must be at most " + e.Param()
+	case "oneof":
+		return "must be one of " + strings.Join(strings.Fields(e.Param()), ", ")
+	case "index_type":
+		return "must be one of " + strings.Join(indexTypeNames(), ", ")
+	case "partition_name", "collection_name":
+		return milvusNameMessage
+	}
+	return fmt.Sprintf("failed the %s rule", e.Tag())
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// collectionNamePattern is the collection naming rule of Milvus. Collection
+// names are also folder names under uploadServerPath, so the rule keeps them
+// from escaping it.
+var collectionNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,254}$`)
+
+// milvusNameMessage explains collectionNamePattern and partitionNamePattern.
+const milvusNameMessage = "must start with a letter or _ and use only letters, digits and _, at most 255 characters"
+
+// uploadExtPattern matches the file extensions kept in stored file names.
+var uploadExtPattern = regexp.MustCompile(`^\.[a-z0-9]{1,10}$`)
+
+// maxOriginalNameLength bounds the original file name kept as metadata, in
+// bytes.
+const maxOriginalNameLength = 255
+
+// uploadNameField is the metadata field holding the original file name.
+const uploadNameField = "upload_name"
+
+var errInvalidFilename = errors.New("invalid file name")
+
+// collectionDir returns the image folder of collection, or false when the
+// name is not a valid collection name.
+func collectionDir(collection string) (string, bool) {
+	if !collectionNamePattern.MatchString(collection) {
+		return "", false
+	}
+	return uploadServerPath + "/" + collection, true
+}
+
+// uploadFilename returns the file name of file as the client sent it. The
+// multipart reader only keeps the base of the name, which would hide
+// traversal attempts.
+func uploadFilename(file *multipart.FileHeader) string {
+	if _, params, err := mime.ParseMediaType(file.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		return params["filename"]
+	}
+	return file.Filename
+}
+
+// originalName checks the name a client gave an uploaded file and returns it
+// cleaned up for the metadata. Names with path elements are refused rather
+// than reduced to their base, since they only come from crafted requests.
+func originalName(name string) (string, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) || !utf8.ValidString(name) {
+		return "", errInvalidFilename
+	}
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errInvalidFilename
+	}
+	return truncate(name, maxOriginalNameLength), nil
+}
+
+// storedName returns a new random file name for an upload called name. Only
+// a plain lowercase extension of name is kept, so that the type of the image
+// is still visible.
+func storedName(name string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	stored := hex.EncodeToString(b)
+	if ext := strings.ToLower(filepath.Ext(name)); uploadExtPattern.MatchString(ext) {
+		stored += ext
+	}
+	return stored, nil
+}
+
+// newStoredName is storedName, replaced by tests to force name collisions.
+var newStoredName = storedName
+
+// saveUpload writes file into dir under a new stored name and returns its
+// path. The file is created exclusively, so an upload never overwrites an
+// image, not even on a name collision.
+func saveUpload(file *multipart.FileHeader, dir string) (string, error) {
+	src, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	var out *os.File
+	var dst string
+	for attempt := 0; out == nil; attempt++ {
+		name, err := newStoredName(file.Filename)
+		if err != nil {
+			return "", err
+		}
+		dst = filepath.Join(dir, name)
+		out, err = os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil && (!os.IsExist(err) || attempt == 2) {
+			return "", err
+		}
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return "", err
+	}
+	return dst, nil
+}
+
+// displayName returns the name an image was uploaded with, as kept in its
+// metadata, or else the base of its stored url.
+func displayName(url string, metadata map[string]interface{}) string {
+	if name, _ := metadata[uploadNameField].(string); name != "" {
+		return name
+	}
+	return filepath.Base(url)
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOriginalName(t *testing.T) {
+	for _, name := range []string{"", ".", "..", "a/b", `a\b`, "../cat.png", `..\cat.png`, "/etc/passwd", "   ", "\x00\x01", "bad\xffutf8.png"} {
+		if got, err := originalName(name); err == nil {
+			t.Errorf("originalName(%q): got %q, want an error", name, got)
+		}
+	}
+	for name, want := range map[string]string{
+		"cat.png":                "cat.png",
+		" my cat .png ":          "my cat .png",
+		"ca\x00t\n.png":          "cat.png",
+		"猫.jpg":                  "猫.jpg",
+		"..cat.png":              "..cat.png",
+		strings.Repeat("a", 300): strings.Repeat("a", maxOriginalNameLength),
+	} {
+		if got, err := originalName(name); err != nil || got != want {
+			t.Errorf("originalName(%q): got %q, %v, want %q", name, got, err, want)
+		}
+	}
+}
+
+func TestStoredName(t *testing.T) {
+	for name, ext := range map[string]string{
+		"cat.png":             ".png",
+		"CAT.JPG":             ".jpg",
+		"a.tar.gz":            ".gz",
+		"noext":               "",
+		"a.<script>":          "",
+		"a.verylongextension": "",
+	} {
+		stored, err := storedName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if filepath.Ext(stored) != ext || len(stored) != 32+len(ext) {
+			t.Errorf("storedName(%q): got %q, want 32 hex digits and %q", name, stored, ext)
+		}
+	}
+	seen := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		stored, _ := storedName("cat.png")
+		if seen[stored] {
+			t.Fatalf("storedName returned %s twice", stored)
+		}
+		seen[stored] = true
+	}
+}
+
+// testFileHeader returns a multipart file header for a file called name.
+func testFileHeader(t *testing.T, name string, content string) *multipart.FileHeader {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("files", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte(content))
+	form.Close()
+	parsed, err := multipart.NewReader(&body, form.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { parsed.RemoveAll() })
+	return parsed.File["files"][0]
+}
+
+func TestSaveUpload(t *testing.T) {
+	dir := t.TempDir()
+	first, err := saveUpload(testFileHeader(t, "cat.png", "a cat"), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := saveUpload(testFileHeader(t, "cat.png", "another cat"), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second || filepath.Dir(first) != dir || filepath.Ext(first) != ".png" {
+		t.Fatalf("saved as %s and %s", first, second)
+	}
+	if data, _ := os.ReadFile(first); string(data) != "a cat" {
+		t.Errorf("first upload: got %q, want %q", data, "a cat")
+	}
+
+	// When every new name is taken, the upload fails rather than overwriting.
+	prev := newStoredName
+	t.Cleanup(func() { newStoredName = prev })
+	newStoredName = func(string) (string, error) { return filepath.Base(first), nil }
+	if dst, err := saveUpload(testFileHeader(t, "cat.png", "an intruder"), dir); !os.IsExist(err) {
+		t.Errorf("save over an existing file: got %s, %v, want an exists error", dst, err)
+	}
+	if data, _ := os.ReadFile(first); string(data) != "a cat" {
+		t.Errorf("existing file: got %q, want %q", data, "a cat")
+	}
+}
+
+func TestCollectionNamePattern(t *testing.T) {
+	for name, want := range map[string]bool{
+		"pets":                   true,
+		"_pets":                  true,
+		"Pets_2":                 true,
+		strings.Repeat("a", 255): true,
+		strings.Repeat("a", 256): false,
+		"":                       false,
+		"2pets":                  false,
+		"pets-2":                 false,
+		"pets.png":               false,
+		"..":                     false,
+		"../pets":                false,
+		"pets/cats":              false,
+		`pets\cats`:              false,
+		"pets\n":                 false,
+		"猫":                      false,
+	} {
+		if got := collectionNamePattern.MatchString(name); got != want {
+			t.Errorf("collectionNamePattern(%q): got %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestImagePath(t *testing.T) {
+	for url, want := range map[string]bool{
+		"uploads/pets/cat.png":          true,
+		"uploads/pets/sub/cat.png":      true,
+		"uploads/pets/./cat.png":        true,
+		"uploads/pets/../pets/cat.png":  true,
+		"uploads/pets":                  false,
+		"uploads/pets/..":               false,
+		"uploads/pets/../cats/cat.png":  false,
+		"uploads/pets/../../etc/passwd": false,
+		"uploads/pets2/cat.png":         false,
+		"/etc/passwd":                   false,
+		"../uploads/pets/cat.png":       false,
+	} {
+		if _, got := imagePath("pets", url); got != want {
+			t.Errorf("imagePath(pets, %q): got %v, want %v", url, got, want)
+		}
+	}
+}
+
+func TestUploadRejectsTraversal(t *testing.T) {
+	ts := newTestServer(t)
+	code, resp := ts.upload("pets", testUpload{"cat.png", "a cat"}, testUpload{"../evil.png", "evil"})
+	if code != http.StatusBadRequest || resp["code"] != codeInvalidParams {
+		t.Fatalf("upload: %d %v", code, resp)
+	}
+	// Nothing of the batch is written, not even the valid file.
+	if _, err := os.Stat(uploadServerPath + "/pets"); !os.IsNotExist(err) {
+		t.Errorf("upload folder created: %v", err)
+	}
+	if _, err := os.Stat(uploadServerPath + "/evil.png"); !os.IsNotExist(err) {
+		t.Errorf("file written outside the collection: %v", err)
+	}
+
+	if code, resp := ts.upload("../pets", testUpload{"cat.png", "a cat"}); code != http.StatusBadRequest || resp["code"] != codeInvalidParams {
+		t.Errorf("upload into ../pets: %d %v", code, resp)
+	}
+}
+
+func TestSearchByImgRejectsTraversal(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createCollection("pets", "FLAT")
+	os.WriteFile("secret.png", []byte("secret"), 0o644)
+	for _, name := range []string{"../../secret.png", "..", `..\secret.png`, "a/b.png"} {
+		params := ts.params("pets")
+		params["index_name"], params["metric_type"], params["search_topk"] = "FLAT", "COSINE", 3
+		params["search_img"] = name
+		if code, resp := ts.do(http.MethodPost, "/api/picSearchByImg", params); code != http.StatusBadRequest || resp["code"] != codeInvalidParams {
+			t.Errorf("search_img %q: %d %v", name, code, resp)
+		}
+	}
+}
+
+func TestUploadNameField(t *testing.T) {
+	ts := newTestServer(t)
+	params := ts.params("pets")
+	params["collection_dim"], params["index_name"], params["metric_type"] = testDim, "FLAT", "COSINE"
+	params["schema_fields"] = []map[string]interface{}{{"name": uploadNameField, "type": "string"}}
+	if code, resp := ts.do(http.MethodPost, "/api/instanceCreate", params); code != http.StatusBadRequest {
+		t.Fatalf("instanceCreate with an %s field: %d %v", uploadNameField, code, resp)
+	}
+	params["schema_fields"] = []map[string]interface{}{{"name": "caption", "type": "string"}}
+	if code, resp := ts.do(http.MethodPost, "/api/instanceCreate", params); code != http.StatusOK {
+		t.Fatalf("instanceCreate with a caption field: %d %v", code, resp)
+	}
+	if code, resp := ts.upload("pets", testUpload{"cat.png", "a cat"}); code != http.StatusOK {
+		t.Fatalf("upload: %d %v", code, resp)
+	}
+	ts.importImages("pets")
+
+	search := ts.params("pets")
+	search["index_name"], search["metric_type"], search["search_topk"] = "FLAT", "COSINE", 3
+	search["search_text"] = "a cat"
+	code, resp := ts.do(http.MethodPost, "/api/picSearchByText", search)
+	if code != http.StatusOK {
+		t.Fatalf("picSearchByText: %d %v", code, resp)
+	}
+	hit := resp["data"].([]interface{})[0].(map[string]interface{})
+	if hit["filename"] != "cat.png" {
+		t.Errorf("filename: got %v, want cat.png", hit["filename"])
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+)
+
+// VectorStore is the storage backend behind the image search handlers. It hides
+// the vector database SDK so that handlers only deal with collections, rows and
+// search hits.
+type VectorStore interface {
+	CreateCollection(ctx context.Context, spec CollectionSpec) error
+	CreateIndex(ctx context.Context, collection string, spec IndexSpec) error
+	LoadCollection(ctx context.Context, collection string) error
+	HasCollection(ctx context.Context, collection string) (bool, error)
+	// Insert adds rows to partition, or to defaultPartition when it is empty.
+	Insert(ctx context.Context, collection string, partition string, rows []VectorRow) error
+	// Search fails with errDimMismatch when the vector does not have the dim
+	// of the collection.
+	Search(ctx context.Context, collection string, req SearchRequest) (SearchResult, error)
+	Delete(ctx context.Context, collection string, ids []int64) error
+	DropCollection(ctx context.Context, collection string) error
+	Stats(ctx context.Context, collection string) (CollectionStats, error)
+	// Describe is Stats with the index and the load state of collection,
+	// which take more calls to gather.
+	Describe(ctx context.Context, collection string) (CollectionInfo, error)
+	ListCollections(ctx context.Context) ([]string, error)
+	// ListFiles returns the id, url and hash of every row in partition, or in
+	// the whole collection when partition is empty.
+	ListFiles(ctx context.Context, collection string, partition string) ([]IndexedFile, error)
+	// FindFiles returns the id, url, hash and partition of the rows in
+	// collection that match filter, a boolean expression like
+	// SearchRequest.Filter.
+	FindFiles(ctx context.Context, collection string, filter string) ([]IndexedFile, error)
+	// QueryImages returns a page of the rows of collection that match
+	// query.Filter, ordered by id, with their stored fields.
+	QueryImages(ctx context.Context, collection string, query ImageQuery) (ImagePage, error)
+	CreatePartition(ctx context.Context, collection string, partition string) error
+	ListPartitions(ctx context.Context, collection string) ([]PartitionInfo, error)
+	// DropPartition removes partition and its rows. defaultPartition cannot
+	// be dropped.
+	DropPartition(ctx context.Context, collection string, partition string) error
+	Close() error
+}
+
+// defaultPartition holds the rows inserted without a partition. Every
+// collection has it.
+const defaultPartition = "_default"
+
+// PartitionInfo describes a partition of a collection.
+type PartitionInfo struct {
+	Name     string
+	RowCount int64
+}
+
+// StoreConfig holds what is needed to open a VectorStore.
+type StoreConfig struct {
+	MilvusServer   string
+	MilvusPort     string
+	MilvusUsername string
+	MilvusPass     string
+}
+
+// CollectionSpec describes a collection holding one float vector per image.
+type CollectionSpec struct {
+	Name        string
+	Description string
+	Dim         int64
+	MetaFields  []MetaField
+}
+
+// IndexSpec describes the vector index built on a collection.
+type IndexSpec struct {
+	IndexType  string
+	MetricType string
+	Params     IndexParams
+}
+
+// IndexParams are the build parameters of an index. M and EfConstruction
+// apply to HNSW, Nlist to the IVF indexes and SCANN, PQM and Nbits to IVF_PQ;
+// zero values take the defaults of the store. PQM has no default and must
+// divide the dimension.
+type IndexParams struct {
+	M              int
+	EfConstruction int
+	Nlist          int
+	PQM            int
+	Nbits          int
+}
+
+// VectorRow is a single image embedding to be inserted.
+type VectorRow struct {
+	Vec []float32
+	Url string
+	// Hash is the hex SHA-256 of the image file. It is dropped by collections
+	// without a hash field.
+	Hash string
+	// Meta holds the metadata of the image by field name. Fields the
+	// collection does not have are dropped.
+	Meta map[string]interface{}
+}
+
+// IndexedFile is the image behind a row already stored in a collection.
+type IndexedFile struct {
+	ID   int64
+	Url  string
+	Hash string
+	// Partition is the partition of the row. It is only set by FindFiles,
+	// and left empty for collections partitioned by a partition key.
+	Partition string
+}
+
+// maxQueryWindow is the largest offset plus limit of an ImageQuery, the
+// default query result window of Milvus.
+const maxQueryWindow = 16384
+
+// ImageQuery selects a page of the rows of a collection. Filter is a boolean
+// expression like SearchRequest.Filter; empty matches every row.
+type ImageQuery struct {
+	Filter string
+	Offset int
+	Limit  int
+}
+
+// ImagePage answers an ImageQuery. Total counts every row matching the
+// filter, not only those on the page.
+type ImagePage struct {
+	Images []StoredImage
+	Total  int64
+}
+
+// StoredImage is a row of a collection read back without a search.
+type StoredImage struct {
+	ID  int64
+	Url string
+	// Metadata holds the other stored fields of the row, as in SearchHit.
+	Metadata map[string]interface{}
+}
+
+// SearchRequest is a single vector similarity query.
+type SearchRequest struct {
+	Vector     []float32
+	TopK       int
+	IndexType  string
+	MetricType string
+	Tuning     SearchTuning
+	// Filter is a Milvus boolean expression over the scalar fields that hits
+	// must match, e.g. `album == "cars"`. Empty matches every row.
+	Filter string
+	// Partitions restricts the search to the named partitions. Empty searches
+	// the whole collection.
+	Partitions []string
+}
+
+// SearchTuning overrides the search parameters of the index. Ef applies to
+// HNSW and is the search_list of DISKANN, Nprobe applies to the IVF indexes
+// and SCANN, ReorderK to SCANN. Zero values take the defaults. Radius and
+// RangeFilter, when set, turn the search into a range search.
+type SearchTuning struct {
+	Ef          int
+	Nprobe      int
+	ReorderK    int
+	Radius      *float64
+	RangeFilter *float64
+}
+
+// rangeParams returns the range search bounds of t as search params.
+func (t SearchTuning) rangeParams() map[string]interface{} {
+	params := map[string]interface{}{}
+	if t.Radius != nil {
+		params["radius"] = *t.Radius
+	}
+	if t.RangeFilter != nil {
+		params["range_filter"] = *t.RangeFilter
+	}
+	return params
+}
+
+// SearchHit is one result of a SearchRequest, ordered best first.
+type SearchHit struct {
+	ID    int64
+	Url   string
+	Score float32
+	// Metadata holds the other stored fields of the row, such as its hash.
+	Metadata map[string]interface{}
+}
+
+// SearchResult answers a SearchRequest and reports the index settings the
+// store actually searched with.
+type SearchResult struct {
+	Hits       []SearchHit
+	IndexType  string
+	MetricType string
+	Params     map[string]interface{}
+}
+
+// CollectionStats reports the shape and size of a collection.
+type CollectionStats struct {
+	Name     string
+	Dim      int64
+	RowCount int64
+	// HasHash reports whether rows keep the hash of their image. Collections
+	// created before hashes were tracked do not.
+	HasHash bool
+	// MetaFields are the metadata fields of the collection, none for
+	// collections created before metadata was stored.
+	MetaFields []MetaField
+}
+
+// CollectionInfo describes a collection and its index.
+type CollectionInfo struct {
+	CollectionStats
+	Description string
+	// IndexType is empty when the collection has no index yet.
+	IndexType   string
+	MetricType  string
+	IndexParams map[string]interface{}
+	// LoadState is one of the loadState constants.
+	LoadState string
+}
+
+// Load states of a collection.
+const (
+	loadStateLoaded    = "loaded"
+	loadStateLoading   = "loading"
+	loadStateNotLoaded = "not_loaded"
+)
+
+// newVectorStore opens the VectorStore used by the handlers. It is a variable
+// so that handlers can be run against an in-memory fake instead of Milvus.
+var newVectorStore = func(ctx context.Context, cfg StoreConfig) (VectorStore, error) {
+	return newMilvusStore(ctx, cfg)
+}
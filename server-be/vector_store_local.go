@@ -0,0 +1,895 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	localStoreExt = ".gob"
+	localLogExt   = ".log"
+	// localLogMinRows is the number of logged rows and ids below which the
+	// log of a collection is never folded into its snapshot.
+	localLogMinRows = 4096
+)
+
+// localStore is an embedded VectorStore that keeps every collection in memory.
+// Collections indexed with HNSW are searched through an hnswGraph, any other
+// index type is answered by exact brute-force scoring. Each collection is
+// persisted to its own snapshot file under dir so that restarts keep imported
+// vectors. Inserts and deletes are appended to a log next to the snapshot
+// instead of rewriting it, and the log is folded into a new snapshot once it
+// holds as many changes as the collection has rows, so that an import costs
+// linear rather than quadratic disk I/O.
+type localStore struct {
+	dir         string
+	opts        localStoreOptions
+	mu          sync.RWMutex
+	rnd         *rand.Rand
+	collections map[string]*localCollection
+}
+
+// localStoreOptions are the HNSW defaults of a localStore.
+type localStoreOptions struct {
+	HNSWM              int
+	HNSWEfConstruction int
+	HNSWEf             int
+}
+
+// localCollection is the persisted state of one collection in a localStore.
+type localCollection struct {
+	Name        string
+	Description string
+	Dim         int64
+	IndexType   string
+	MetricType  string
+	// HNSWM and HNSWEfConstruction are the build parameters given when the
+	// index was created; zero takes the store options.
+	HNSWM              int
+	HNSWEfConstruction int
+	MetaFields         []MetaField
+	// Partitions are the partitions created besides defaultPartition.
+	Partitions []string
+	Loaded     bool
+	NextID     int64
+	// Rows are kept in insertion order; row i is node i of Graph. Deleted
+	// rows stay in place as tombstones while Graph is set.
+	Rows    []localRow
+	Deleted int
+	Graph   *hnswGraph
+	// logged counts the rows and ids in the log since the last snapshot.
+	logged int
+}
+
+// localLogEntry is one change appended to the log of a collection: rows
+// inserted, with their ids assigned, or ids deleted.
+type localLogEntry struct {
+	Rows    []localRow
+	Deleted []int64
+}
+
+type localRow struct {
+	ID   int64
+	Vec  []float32
+	Url  string
+	Hash string
+	Meta map[string]interface{}
+	// Partition is empty for rows of defaultPartition.
+	Partition string
+	Deleted   bool
+}
+
+func init() {
+	// Metadata values are stored as interfaces; gob needs to know the
+	// composite types of the extra JSON field.
+	gob.Register(map[string]interface{}{})
+	gob.Register([]interface{}{})
+}
+
+// openLocalStore loads every collection file found in dir, creating dir if it
+// does not exist yet.
+func openLocalStore(dir string, opts localStoreOptions) (*localStore, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	s := &localStore{
+		dir:         dir,
+		opts:        opts,
+		rnd:         rand.New(rand.NewSource(rand.Int63())),
+		collections: map[string]*localCollection{},
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != localStoreExt {
+			continue
+		}
+		coll, err := readLocalCollection(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s: %w", entry.Name(), err)
+		}
+		if coll.IndexType == "HNSW" && coll.Graph == nil {
+			if err := s.buildGraph(coll); err != nil {
+				return nil, fmt.Errorf("failed to index %s: %w", coll.Name, err)
+			}
+		}
+		if err := s.replayLog(coll); err != nil {
+			return nil, fmt.Errorf("failed to replay the log of %s: %w", coll.Name, err)
+		}
+		s.collections[coll.Name] = coll
+	}
+	log.Printf(msgFmt, fmt.Sprintf("local vector store opened: %s, %d collections", dir, len(s.collections)))
+	return s, nil
+}
+
+func readLocalCollection(path string) (*localCollection, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var coll localCollection
+	if err := gob.NewDecoder(f).Decode(&coll); err != nil {
+		return nil, err
+	}
+	return &coll, nil
+}
+
+// replayLog applies the log of coll to the snapshot just read, then folds it
+// into a new snapshot. Inserted rows whose ids the snapshot already covers
+// are skipped and deletes are idempotent, so a crash between writing a
+// snapshot and removing the log replays nothing twice. A torn last entry,
+// left by a crash during an append, is dropped.
+func (s *localStore) replayLog(coll *localCollection) error {
+	data, err := os.ReadFile(filepath.Join(s.dir, coll.Name+localLogExt))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var space hnswSpace
+	if coll.Graph != nil {
+		if space, err = s.space(coll); err != nil {
+			return err
+		}
+	}
+	for len(data) > 0 {
+		if len(data) < 4 || int(binary.BigEndian.Uint32(data)) > len(data)-4 {
+			log.Printf(msgFmt, "dropping a torn entry at the end of the log of "+coll.Name)
+			break
+		}
+		n := int(binary.BigEndian.Uint32(data))
+		var entry localLogEntry
+		if err := gob.NewDecoder(bytes.NewReader(data[4 : 4+n])).Decode(&entry); err != nil {
+			return err
+		}
+		data = data[4+n:]
+		for _, row := range entry.Rows {
+			if row.ID < coll.NextID {
+				continue
+			}
+			coll.Rows = append(coll.Rows, row)
+			coll.NextID = row.ID + 1
+			if coll.Graph != nil {
+				coll.Graph.Add(space, s.rnd)
+			}
+		}
+		if len(entry.Deleted) > 0 {
+			drop := make(map[int64]bool, len(entry.Deleted))
+			for _, id := range entry.Deleted {
+				drop[id] = true
+			}
+			if err := s.deleteRows(coll, func(row localRow) bool { return drop[row.ID] }); err != nil {
+				return err
+			}
+		}
+	}
+	return s.save(coll)
+}
+
+// appendLog records entry, already applied to coll in memory, in the log of
+// coll. Once the log holds as many rows and ids as coll has rows, a snapshot
+// is written instead, which keeps both replay and the total snapshot I/O of
+// a growing collection linear.
+func (s *localStore) appendLog(coll *localCollection, entry localLogEntry) error {
+	changes := len(entry.Rows) + len(entry.Deleted)
+	if coll.logged+changes >= max(localLogMinRows, len(coll.Rows)) {
+		return s.save(coll)
+	}
+	var buf bytes.Buffer
+	buf.Write(make([]byte, 4))
+	if err := gob.NewEncoder(&buf).Encode(entry); err != nil {
+		return err
+	}
+	data := buf.Bytes()
+	binary.BigEndian.PutUint32(data, uint32(len(data)-4))
+	f, err := os.OpenFile(filepath.Join(s.dir, coll.Name+localLogExt), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	coll.logged += changes
+	return nil
+}
+
+// save writes a snapshot of coll to disk and drops its log. It writes to a
+// temporary file first so that a crash never leaves a truncated collection
+// behind.
+func (s *localStore) save(coll *localCollection) error {
+	path := filepath.Join(s.dir, coll.Name+localStoreExt)
+	tmp, err := os.CreateTemp(s.dir, coll.Name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(tmp).Encode(coll); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(s.dir, coll.Name+localLogExt)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	coll.logged = 0
+	return nil
+}
+
+func (s *localStore) collection(name string) (*localCollection, error) {
+	coll, ok := s.collections[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errCollectionNotFound, name)
+	}
+	return coll, nil
+}
+
+func (s *localStore) CreateCollection(ctx context.Context, spec CollectionSpec) error {
+	if spec.Name == "" || strings.ContainsAny(spec.Name, `/\.`) {
+		return fmt.Errorf("invalid collection name: %q", spec.Name)
+	}
+	if spec.Dim <= 0 {
+		return fmt.Errorf("invalid dim: %d", spec.Dim)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.collections[spec.Name]; ok {
+		return fmt.Errorf("%w: %s", errCollectionExists, spec.Name)
+	}
+	coll := &localCollection{Name: spec.Name, Description: spec.Description, Dim: spec.Dim, MetaFields: spec.MetaFields, NextID: 1}
+	if err := s.save(coll); err != nil {
+		return err
+	}
+	s.collections[spec.Name] = coll
+	return nil
+}
+
+func (s *localStore) CreateIndex(ctx context.Context, collection string, spec IndexSpec) error {
+	if _, err := lookupIndexType(spec.IndexType); err != nil {
+		return err
+	}
+	if _, err := localScorer(spec.MetricType); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	coll, err := s.collection(collection)
+	if err != nil {
+		return err
+	}
+	coll.IndexType = spec.IndexType
+	coll.MetricType = spec.MetricType
+	coll.HNSWM = spec.Params.M
+	coll.HNSWEfConstruction = spec.Params.EfConstruction
+	coll.Graph = nil
+	s.compact(coll)
+	if coll.IndexType == "HNSW" {
+		if err := s.buildGraph(coll); err != nil {
+			return err
+		}
+	}
+	return s.save(coll)
+}
+
+func (s *localStore) LoadCollection(ctx context.Context, collection string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	coll, err := s.collection(collection)
+	if err != nil {
+		return err
+	}
+	if coll.Loaded {
+		return nil
+	}
+	coll.Loaded = true
+	return s.save(coll)
+}
+
+func (s *localStore) HasCollection(ctx context.Context, collection string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.collections[collection]
+	return ok, nil
+}
+
+func (s *localStore) Insert(ctx context.Context, collection string, partition string, rows []VectorRow) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	coll, err := s.collection(collection)
+	if err != nil {
+		return err
+	}
+	if partition == defaultPartition {
+		partition = ""
+	}
+	if partition != "" && !slices.Contains(coll.Partitions, partition) {
+		return fmt.Errorf("%w: %s.%s", errPartitionNotFound, collection, partition)
+	}
+	for _, row := range rows {
+		if int64(len(row.Vec)) != coll.Dim {
+			return fmt.Errorf("%w: vector dim %d does not match collection dim %d", errDimMismatch, len(row.Vec), coll.Dim)
+		}
+	}
+	var space hnswSpace
+	if coll.Graph != nil {
+		space, _ = s.space(coll)
+	}
+	first := len(coll.Rows)
+	for _, row := range rows {
+		stored := localRow{ID: coll.NextID, Vec: row.Vec, Url: row.Url, Hash: row.Hash, Partition: partition}
+		if len(coll.MetaFields) > 0 {
+			stored.Meta = rowMeta(coll.MetaFields, row.Meta)
+		}
+		coll.Rows = append(coll.Rows, stored)
+		coll.NextID++
+		if coll.Graph != nil {
+			coll.Graph.Add(space, s.rnd)
+		}
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	return s.appendLog(coll, localLogEntry{Rows: coll.Rows[first:]})
+}
+
+func (s *localStore) Search(ctx context.Context, collection string, req SearchRequest) (SearchResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	coll, err := s.collection(collection)
+	if err != nil {
+		return SearchResult{}, err
+	}
+	if !coll.Loaded {
+		return SearchResult{}, fmt.Errorf("collection %s is not loaded", collection)
+	}
+	if int64(len(req.Vector)) != coll.Dim {
+		return SearchResult{}, fmt.Errorf("%w: vector dim %d does not match collection dim %d", errDimMismatch, len(req.Vector), coll.Dim)
+	}
+	metric := req.MetricType
+	if metric == "" {
+		metric = coll.MetricType
+	}
+	scorer, err := localScorer(metric)
+	if err != nil {
+		return SearchResult{}, err
+	}
+	if req.IndexType != "" {
+		if _, err := lookupIndexType(req.IndexType); err != nil {
+			return SearchResult{}, err
+		}
+	}
+	var filter filterExpr
+	if strings.TrimSpace(req.Filter) != "" {
+		if filter, err = compileFilter(req.Filter, coll.fieldNames()); err != nil {
+			return SearchResult{}, err
+		}
+	}
+	var partitions map[string]bool
+	if len(req.Partitions) > 0 {
+		partitions = map[string]bool{}
+		for _, name := range req.Partitions {
+			if name != defaultPartition && !slices.Contains(coll.Partitions, name) {
+				return SearchResult{}, fmt.Errorf("%w: %s.%s", errPartitionNotFound, collection, name)
+			}
+			partitions[name] = true
+		}
+	}
+	match := func(row localRow) bool {
+		if row.Deleted || (partitions != nil && !partitions[row.partition()]) {
+			return false
+		}
+		return filter == nil || matchFilter(filter, row.fields())
+	}
+
+	// A FLAT search is exact, so it scans every row even when there is a graph.
+	if coll.Graph != nil && metric == coll.MetricType && req.IndexType != "FLAT" {
+		hits, ef := s.searchGraph(coll, scorer, req, match)
+		params := req.Tuning.rangeParams()
+		params["ef"] = ef
+		return SearchResult{Hits: hits, IndexType: "HNSW", MetricType: metric, Params: params}, nil
+	}
+
+	hits := make([]SearchHit, 0, len(coll.Rows))
+	for _, row := range coll.Rows {
+		if !match(row) {
+			continue
+		}
+		score := scorer.score(req.Vector, row.Vec)
+		if scorer.withinRadius(score, req.Tuning) && scorer.withinRangeFilter(score, req.Tuning) {
+			hits = append(hits, row.hit(score))
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		return scorer.better(hits[i].Score, hits[j].Score)
+	})
+	if req.TopK >= 0 && len(hits) > req.TopK {
+		hits = hits[:req.TopK]
+	}
+	// Without a graph every row is scored, which is what a FLAT index does.
+	return SearchResult{Hits: hits, IndexType: "FLAT", MetricType: metric, Params: req.Tuning.rangeParams()}, nil
+}
+
+func (row localRow) partition() string {
+	if row.Partition == "" {
+		return defaultPartition
+	}
+	return row.Partition
+}
+
+func (row localRow) hit(score float32) SearchHit {
+	return SearchHit{ID: row.ID, Url: row.Url, Score: score, Metadata: row.metadata()}
+}
+
+// metadata returns the hash and metadata of row, or nil when it has neither.
+func (row localRow) metadata() map[string]interface{} {
+	if row.Hash == "" && len(row.Meta) == 0 {
+		return nil
+	}
+	metadata := make(map[string]interface{}, len(row.Meta)+1)
+	for name, value := range row.Meta {
+		metadata[name] = value
+	}
+	if row.Hash != "" {
+		metadata["hash"] = row.Hash
+	}
+	return metadata
+}
+
+// fields returns the scalar fields of row by name, for filters.
+func (row localRow) fields() map[string]interface{} {
+	fields := make(map[string]interface{}, len(row.Meta)+3)
+	for name, value := range row.Meta {
+		fields[name] = value
+	}
+	fields["id"] = row.ID
+	fields["url"] = row.Url
+	fields["hash"] = row.Hash
+	return fields
+}
+
+// fieldNames returns the scalar fields a filter on coll may use.
+func (coll *localCollection) fieldNames() map[string]bool {
+	names := map[string]bool{"id": true, "url": true, "hash": true}
+	for _, field := range coll.MetaFields {
+		names[field.Name] = true
+	}
+	return names
+}
+
+func (s *localStore) Delete(ctx context.Context, collection string, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	coll, err := s.collection(collection)
+	if err != nil {
+		return err
+	}
+	drop := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		drop[id] = true
+	}
+	if err := s.deleteRows(coll, func(row localRow) bool { return drop[row.ID] }); err != nil {
+		return err
+	}
+	return s.appendLog(coll, localLogEntry{Deleted: ids})
+}
+
+// deleteRows marks the live rows of coll for which drop is true as deleted.
+func (s *localStore) deleteRows(coll *localCollection, drop func(row localRow) bool) error {
+	for i := range coll.Rows {
+		if !coll.Rows[i].Deleted && drop(coll.Rows[i]) {
+			coll.Rows[i].Deleted = true
+			coll.Deleted++
+		}
+	}
+	// Tombstones keep the graph navigable; once they make up half of the
+	// collection the rows are compacted and the graph is rebuilt.
+	if coll.Graph == nil || coll.Deleted*2 > len(coll.Rows) {
+		s.compact(coll)
+		if coll.Graph != nil {
+			return s.buildGraph(coll)
+		}
+	}
+	return nil
+}
+
+func (s *localStore) DropCollection(ctx context.Context, collection string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.collection(collection); err != nil {
+		return err
+	}
+	for _, ext := range []string{localStoreExt, localLogExt} {
+		err := os.Remove(filepath.Join(s.dir, collection+ext))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	delete(s.collections, collection)
+	return nil
+}
+
+func (s *localStore) Stats(ctx context.Context, collection string) (CollectionStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	coll, err := s.collection(collection)
+	if err != nil {
+		return CollectionStats{Name: collection}, err
+	}
+	return CollectionStats{Name: coll.Name, Dim: coll.Dim, RowCount: int64(len(coll.Rows) - coll.Deleted), HasHash: true, MetaFields: coll.MetaFields}, nil
+}
+
+func (s *localStore) Describe(ctx context.Context, collection string) (CollectionInfo, error) {
+	stats, err := s.Stats(ctx, collection)
+	if err != nil {
+		return CollectionInfo{CollectionStats: stats}, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	coll, err := s.collection(collection)
+	if err != nil {
+		return CollectionInfo{CollectionStats: stats}, err
+	}
+	info := CollectionInfo{
+		CollectionStats: stats,
+		Description:     coll.Description,
+		IndexType:       coll.IndexType,
+		MetricType:      coll.MetricType,
+		IndexParams:     map[string]interface{}{},
+		LoadState:       loadStateNotLoaded,
+	}
+	if coll.IndexType == "HNSW" {
+		info.IndexParams["M"] = orDefault(coll.HNSWM, s.opts.HNSWM)
+		info.IndexParams["efConstruction"] = orDefault(coll.HNSWEfConstruction, s.opts.HNSWEfConstruction)
+	}
+	if coll.Loaded {
+		info.LoadState = loadStateLoaded
+	}
+	return info, nil
+}
+
+func (s *localStore) ListCollections(ctx context.Context) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.collections))
+	for name := range s.collections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *localStore) ListFiles(ctx context.Context, collection string, partition string) ([]IndexedFile, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	coll, err := s.collection(collection)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]IndexedFile, 0, len(coll.Rows)-coll.Deleted)
+	for _, row := range coll.Rows {
+		if !row.Deleted && (partition == "" || row.partition() == partition) {
+			files = append(files, IndexedFile{ID: row.ID, Url: row.Url, Hash: row.Hash})
+		}
+	}
+	return files, nil
+}
+
+func (s *localStore) FindFiles(ctx context.Context, collection string, filter string) ([]IndexedFile, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	coll, err := s.collection(collection)
+	if err != nil {
+		return nil, err
+	}
+	var expr filterExpr
+	if strings.TrimSpace(filter) != "" {
+		if expr, err = compileFilter(filter, coll.fieldNames()); err != nil {
+			return nil, err
+		}
+	}
+	var files []IndexedFile
+	for _, row := range coll.Rows {
+		if !row.Deleted && (expr == nil || matchFilter(expr, row.fields())) {
+			files = append(files, IndexedFile{ID: row.ID, Url: row.Url, Hash: row.Hash, Partition: row.partition()})
+		}
+	}
+	return files, nil
+}
+
+// QueryImages relies on ids growing with the row order, so the matching rows
+// are already sorted by id.
+func (s *localStore) QueryImages(ctx context.Context, collection string, query ImageQuery) (ImagePage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	coll, err := s.collection(collection)
+	if err != nil {
+		return ImagePage{}, err
+	}
+	var expr filterExpr
+	if strings.TrimSpace(query.Filter) != "" {
+		if expr, err = compileFilter(query.Filter, coll.fieldNames()); err != nil {
+			return ImagePage{}, err
+		}
+	}
+	var page ImagePage
+	for _, row := range coll.Rows {
+		if row.Deleted || (expr != nil && !matchFilter(expr, row.fields())) {
+			continue
+		}
+		if page.Total >= int64(query.Offset) && len(page.Images) < query.Limit {
+			page.Images = append(page.Images, StoredImage{ID: row.ID, Url: row.Url, Metadata: row.metadata()})
+		}
+		page.Total++
+	}
+	return page, nil
+}
+
+// CreatePartition adds partition to collection. Like Milvus, it refuses
+// collections with a partition key field, whose partitions are not managed
+// by hand.
+func (s *localStore) CreatePartition(ctx context.Context, collection string, partition string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	coll, err := s.collection(collection)
+	if err != nil {
+		return err
+	}
+	if field, ok := partitionKeyField(coll.MetaFields); ok {
+		return fmt.Errorf("%w: collection %s is partitioned by %s", errInvalidPartition, collection, field.Name)
+	}
+	if partition == defaultPartition || slices.Contains(coll.Partitions, partition) {
+		return fmt.Errorf("%w: %s.%s", errPartitionExists, collection, partition)
+	}
+	coll.Partitions = append(coll.Partitions, partition)
+	return s.save(coll)
+}
+
+func (s *localStore) ListPartitions(ctx context.Context, collection string) ([]PartitionInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	coll, err := s.collection(collection)
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]int64{}
+	for _, row := range coll.Rows {
+		if !row.Deleted {
+			counts[row.partition()]++
+		}
+	}
+	infos := []PartitionInfo{{Name: defaultPartition, RowCount: counts[defaultPartition]}}
+	for _, name := range coll.Partitions {
+		infos = append(infos, PartitionInfo{Name: name, RowCount: counts[name]})
+	}
+	return infos, nil
+}
+
+func (s *localStore) DropPartition(ctx context.Context, collection string, partition string) error {
+	if partition == defaultPartition {
+		return fmt.Errorf("%w: the %s partition cannot be dropped", errInvalidPartition, defaultPartition)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	coll, err := s.collection(collection)
+	if err != nil {
+		return err
+	}
+	i := slices.Index(coll.Partitions, partition)
+	if i < 0 {
+		return fmt.Errorf("%w: %s.%s", errPartitionNotFound, collection, partition)
+	}
+	if err := s.deleteRows(coll, func(row localRow) bool { return row.Partition == partition }); err != nil {
+		return err
+	}
+	coll.Partitions = slices.Delete(coll.Partitions, i, i+1)
+	return s.save(coll)
+}
+
+// Close is a no-op: the local store is shared by all requests and lives as long
+// as the process.
+func (s *localStore) Close() error {
+	return nil
+}
+
+// compact removes deleted rows. The caller must rebuild the graph afterwards.
+func (s *localStore) compact(coll *localCollection) {
+	if coll.Deleted == 0 {
+		return
+	}
+	kept := coll.Rows[:0]
+	for _, row := range coll.Rows {
+		if !row.Deleted {
+			kept = append(kept, row)
+		}
+	}
+	coll.Rows = kept
+	coll.Deleted = 0
+}
+
+// space returns the hnswSpace over the rows of coll for its metric type.
+func (s *localStore) space(coll *localCollection) (hnswSpace, error) {
+	sc, err := localScorer(coll.MetricType)
+	if err != nil {
+		return hnswSpace{}, err
+	}
+	distance := sc.score
+	if sc.higherIsBetter {
+		distance = func(a, b []float32) float32 { return -sc.score(a, b) }
+	}
+	return hnswSpace{
+		vector:   func(node int32) []float32 { return coll.Rows[node].Vec },
+		distance: distance,
+	}, nil
+}
+
+// buildGraph indexes every row of coll into a new HNSW graph.
+func (s *localStore) buildGraph(coll *localCollection) error {
+	space, err := s.space(coll)
+	if err != nil {
+		return err
+	}
+	coll.Graph = newHNSWGraph(orDefault(coll.HNSWM, s.opts.HNSWM), orDefault(coll.HNSWEfConstruction, s.opts.HNSWEfConstruction))
+	for range coll.Rows {
+		coll.Graph.Add(space, s.rnd)
+	}
+	return nil
+}
+
+// searchGraph answers req from the HNSW graph of coll and returns the ef it
+// started with. The beam is widened until enough rows accepted by match are
+// found, since tombstones and filtered rows still take part in the
+// traversal.
+func (s *localStore) searchGraph(coll *localCollection, sc scorer, req SearchRequest, match func(row localRow) bool) ([]SearchHit, int) {
+	space, _ := s.space(coll)
+	live := len(coll.Rows) - coll.Deleted
+	topk := min(req.TopK, live)
+	ef := max(orDefault(req.Tuning.Ef, s.opts.HNSWEf), topk)
+	if topk <= 0 {
+		return nil, ef
+	}
+	startEf := ef
+	for {
+		found := coll.Graph.Search(space, req.Vector, ef)
+		hits := make([]SearchHit, 0, topk)
+		for _, c := range found {
+			row := coll.Rows[c.node]
+			if !match(row) {
+				continue
+			}
+			score := sc.score(req.Vector, row.Vec)
+			// found is sorted, so the rest are outside the radius as well.
+			if !sc.withinRadius(score, req.Tuning) {
+				return hits, startEf
+			}
+			if !sc.withinRangeFilter(score, req.Tuning) {
+				continue
+			}
+			hits = append(hits, row.hit(score))
+			if len(hits) == topk {
+				return hits, startEf
+			}
+		}
+		if ef >= len(coll.Rows) {
+			return hits, startEf
+		}
+		ef *= 2
+	}
+}
+
+// scorer computes the similarity of two vectors for one metric type and knows
+// whether a higher or a lower score is the better match.
+type scorer struct {
+	score          func(a, b []float32) float32
+	higherIsBetter bool
+}
+
+func (sc scorer) better(a, b float32) bool {
+	if sc.higherIsBetter {
+		return a > b
+	}
+	return a < b
+}
+
+// withinRadius and withinRangeFilter check score against the range search
+// bounds of t the way Milvus does: range_filter <= score < radius for L2, and
+// radius < score <= range_filter for IP and COSINE.
+func (sc scorer) withinRadius(score float32, t SearchTuning) bool {
+	return t.Radius == nil || sc.better(score, float32(*t.Radius))
+}
+
+func (sc scorer) withinRangeFilter(score float32, t SearchTuning) bool {
+	return t.RangeFilter == nil || !sc.better(score, float32(*t.RangeFilter))
+}
+
+// localScorer returns the scorer for a Milvus metric type name. L2 scores are
+// squared distances, matching what Milvus returns.
+func localScorer(metricType string) (scorer, error) {
+	switch metricType {
+	case "IP":
+		return scorer{score: innerProduct, higherIsBetter: true}, nil
+	case "L2":
+		return scorer{score: squaredL2, higherIsBetter: false}, nil
+	case "COSINE":
+		return scorer{score: cosine, higherIsBetter: true}, nil
+	}
+	return scorer{}, fmt.Errorf("unsupported metric type: %q", metricType)
+}
+
+func innerProduct(a, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+func squaredL2(a, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		d := a[i] - b[i]
+		sum += d * d
+	}
+	return sum
+}
+
+func cosine(a, b []float32) float32 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return float32(dot / (math.Sqrt(na) * math.Sqrt(nb)))
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testLocalStore opens a local store in a temporary directory with a FLAT
+// collection "c" of dim 4.
+func testLocalStore(t *testing.T, dir string) *localStore {
+	t.Helper()
+	store, err := openLocalStore(dir, localStoreOptions{HNSWM: 8, HNSWEfConstruction: 40, HNSWEf: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if has, _ := store.HasCollection(ctx, "c"); !has {
+		if err := store.CreateCollection(ctx, CollectionSpec{Name: "c", Dim: 4}); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.CreateIndex(ctx, "c", IndexSpec{IndexType: "FLAT", MetricType: "L2"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+func randomRows(rnd *rand.Rand, n int, dim int) []VectorRow {
+	rows := make([]VectorRow, n)
+	for i := range rows {
+		vec := make([]float32, dim)
+		for j := range vec {
+			vec[j] = rnd.Float32()
+		}
+		rows[i] = VectorRow{Vec: vec, Url: "uploads/c/img.png"}
+	}
+	return rows
+}
+
+func TestLocalStoreLogReplay(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	store := testLocalStore(t, dir)
+	snapshot := filepath.Join(dir, "c"+localStoreExt)
+	before, err := os.Stat(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 10; i++ {
+		if err := store.Insert(ctx, "c", "", randomRows(rnd, 10, 4)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Delete(ctx, "c", []int64{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	// Small batches go to the log; the snapshot is left alone.
+	if after, _ := os.Stat(snapshot); after.Size() != before.Size() || !after.ModTime().Equal(before.ModTime()) {
+		t.Error("snapshot rewritten by a small insert")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "c"+localLogExt)); err != nil {
+		t.Fatalf("no log: %v", err)
+	}
+
+	reopened := testLocalStore(t, dir)
+	files, err := reopened.ListFiles(ctx, "c", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 97 || files[0].ID != 4 || files[len(files)-1].ID != 100 {
+		t.Fatalf("after replay: got %d rows from id %d, want 97 rows from id 4", len(files), files[0].ID)
+	}
+	// Opening folds the log into the snapshot.
+	if _, err := os.Stat(filepath.Join(dir, "c"+localLogExt)); !os.IsNotExist(err) {
+		t.Errorf("log left after replay: %v", err)
+	}
+	if err := reopened.Insert(ctx, "c", "", randomRows(rnd, 1, 4)); err != nil {
+		t.Fatal(err)
+	}
+	files, _ = reopened.ListFiles(ctx, "c", "")
+	if last := files[len(files)-1].ID; last != 101 {
+		t.Errorf("id after replay: got %d, want 101", last)
+	}
+}
+
+func TestLocalStoreLogTornEntry(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	store := testLocalStore(t, dir)
+	rnd := rand.New(rand.NewSource(2))
+	for i := 0; i < 2; i++ {
+		if err := store.Insert(ctx, "c", "", randomRows(rnd, 5, 4)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	logPath := filepath.Join(dir, "c"+localLogExt)
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A crash in the middle of the second append.
+	if err := os.WriteFile(logPath, data[:len(data)-10], 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := testLocalStore(t, dir).Stats(ctx, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.RowCount != 5 {
+		t.Errorf("rows after a torn append: got %d, want 5", stats.RowCount)
+	}
+}
+
+func TestLocalStoreLogCompaction(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	store := testLocalStore(t, dir)
+	rnd := rand.New(rand.NewSource(3))
+	if err := store.Insert(ctx, "c", "", randomRows(rnd, localLogMinRows-1, 4)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "c"+localLogExt)); err != nil {
+		t.Fatalf("no log: %v", err)
+	}
+	// Reaching localLogMinRows writes a snapshot and drops the log.
+	if err := store.Insert(ctx, "c", "", randomRows(rnd, 1, 4)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "c"+localLogExt)); !os.IsNotExist(err) {
+		t.Errorf("log left after compaction: %v", err)
+	}
+	stats, _ := testLocalStore(t, dir).Stats(ctx, "c")
+	if stats.RowCount != localLogMinRows {
+		t.Errorf("rows after compaction: got %d, want %d", stats.RowCount, localLogMinRows)
+	}
+}
@@ -0,0 +1,678 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/milvus-io/milvus-sdk-go/v2/client"
+	"github.com/milvus-io/milvus-sdk-go/v2/entity"
+	"google.golang.org/grpc"
+)
+
+const (
+	milvusVecField  = "vec"
+	milvusUrlField  = "url"
+	milvusHashField = "hash"
+)
+
+// milvusStore is the VectorStore backed by a Milvus server. Its client is
+// borrowed from milvusClients and given back by Close.
+type milvusStore struct {
+	c    client.Client
+	conn *pooledMilvus
+}
+
+func get_milvus_client(ctx context.Context, milvus_server string, milvus_port string, milvus_username string, milvus_pass string) (client.Client, error) {
+	milvusAddr := milvus_server + `:` + milvus_port
+	log.Printf(msgFmt, "start connecting to Milvus: "+milvusAddr)
+	c, err := client.NewClient(ctx, client.Config{
+		Address:  milvusAddr,
+		Username: milvus_username,
+		Password: milvus_pass,
+		DialOptions: []grpc.DialOption{
+			grpc.WithBlock(),
+			grpc.WithTimeout(time.Duration((10000) * 1000 * 1000)),
+		},
+	})
+	return c, err
+}
+
+func newMilvusStore(ctx context.Context, cfg StoreConfig) (*milvusStore, error) {
+	conn, c, err := milvusClients.acquire(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &milvusStore{c: c, conn: conn}, nil
+}
+
+func (s *milvusStore) CreateCollection(ctx context.Context, spec CollectionSpec) error {
+	schema := entity.NewSchema().WithName(spec.Name).WithDescription(spec.Description).
+		WithField(entity.NewField().WithName("id").WithDataType(entity.FieldTypeInt64).WithIsPrimaryKey(true).WithIsAutoID(true)).
+		WithField(entity.NewField().WithName(milvusVecField).WithDataType(entity.FieldTypeFloatVector).WithDim(spec.Dim)).
+		WithField(entity.NewField().WithName(milvusUrlField).WithDataType(entity.FieldTypeVarChar).WithMaxLength(500)).
+		WithField(entity.NewField().WithName(milvusHashField).WithDataType(entity.FieldTypeVarChar).WithMaxLength(64))
+	for _, field := range spec.MetaFields {
+		schema.WithField(milvusMetaField(field))
+	}
+	s.conn.forgetSchema(spec.Name)
+	return milvusError(spec.Name, s.c.CreateCollection(ctx, schema, entity.DefaultShardNumber))
+}
+
+func (s *milvusStore) CreateIndex(ctx context.Context, collection string, spec IndexSpec) error {
+	it, err := lookupIndexType(spec.IndexType)
+	if err != nil {
+		return err
+	}
+	idx, err := it.newIndex(entity.MetricType(spec.MetricType), spec.Params)
+	if err != nil {
+		return fmt.Errorf("failed to create %s index: %w", spec.IndexType, err)
+	}
+	log.Printf(msgFmt, "start creating index "+spec.IndexType)
+	return milvusError(collection, s.c.CreateIndex(ctx, collection, milvusVecField, idx, false))
+}
+
+func (s *milvusStore) LoadCollection(ctx context.Context, collection string) error {
+	return milvusError(collection, s.c.LoadCollection(ctx, collection, false))
+}
+
+func (s *milvusStore) HasCollection(ctx context.Context, collection string) (bool, error) {
+	return s.c.HasCollection(ctx, collection)
+}
+
+func (s *milvusStore) Insert(ctx context.Context, collection string, partition string, rows []VectorRow) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	hasHash, metaFields, err := s.scalarFields(ctx, collection)
+	if err != nil {
+		return err
+	}
+	vecs := make([][]float32, 0, len(rows))
+	urls := make([]string, 0, len(rows))
+	hashes := make([]string, 0, len(rows))
+	for _, row := range rows {
+		vecs = append(vecs, row.Vec)
+		urls = append(urls, row.Url)
+		hashes = append(hashes, row.Hash)
+	}
+	columns := []entity.Column{
+		entity.NewColumnFloatVector(milvusVecField, len(rows[0].Vec), vecs),
+		entity.NewColumnVarChar(milvusUrlField, urls),
+	}
+	if hasHash {
+		columns = append(columns, entity.NewColumnVarChar(milvusHashField, hashes))
+	}
+	for _, field := range metaFields {
+		columns = append(columns, metaColumn(field, rows))
+	}
+	_, err = s.c.Insert(ctx, collection, partition, columns...)
+	return milvusError(collection, err)
+}
+
+// schema returns the schema of collection. Schemas do not change once a
+// collection is created, so they are cached with the pooled client and only
+// described again after this server dropped or created the collection.
+func (s *milvusStore) schema(ctx context.Context, collection string) (*entity.Schema, error) {
+	if schema := s.conn.schema(collection); schema != nil {
+		return schema, nil
+	}
+	coll, err := s.c.DescribeCollection(ctx, collection)
+	if err != nil {
+		return nil, milvusError(collection, err)
+	}
+	s.conn.cacheSchema(collection, coll.Schema)
+	return coll.Schema, nil
+}
+
+// scalarFields reports whether collection was created with the hash field,
+// and which metadata fields it has.
+func (s *milvusStore) scalarFields(ctx context.Context, collection string) (bool, []MetaField, error) {
+	schema, err := s.schema(ctx, collection)
+	if err != nil {
+		return false, nil, err
+	}
+	hasHash, metaFields := schemaScalarFields(schema)
+	return hasHash, metaFields, nil
+}
+
+// schemaDim returns the dim of the vector field of schema.
+func schemaDim(schema *entity.Schema) int64 {
+	for _, field := range schema.Fields {
+		if field.Name == milvusVecField {
+			dim, _ := strconv.ParseInt(field.TypeParams[entity.TypeParamDim], 10, 64)
+			return dim
+		}
+	}
+	return 0
+}
+
+func schemaScalarFields(schema *entity.Schema) (bool, []MetaField) {
+	hasHash := false
+	var metaFields []MetaField
+	for _, field := range schema.Fields {
+		switch field.Name {
+		case "id", milvusVecField, milvusUrlField:
+		case milvusHashField:
+			hasHash = true
+		default:
+			if meta, ok := metaFieldOf(field); ok {
+				metaFields = append(metaFields, meta)
+			}
+		}
+	}
+	return hasHash, metaFields
+}
+
+// metaFieldOptions are the options of a metadata field that have no place in
+// the Milvus schema. They are kept as JSON in the description of the field.
+type metaFieldOptions struct {
+	Nullable bool        `json:"nullable,omitempty"`
+	Default  interface{} `json:"default,omitempty"`
+}
+
+// milvusMetaField returns the schema field storing a metadata field.
+func milvusMetaField(field MetaField) *entity.Field {
+	f := entity.NewField().WithName(field.Name).WithIsPartitionKey(field.PartitionKey)
+	switch field.Type {
+	case metaTypeString:
+		f.WithDataType(entity.FieldTypeVarChar).WithMaxLength(field.MaxLength)
+	case metaTypeInt:
+		f.WithDataType(entity.FieldTypeInt64)
+	case metaTypeFloat:
+		f.WithDataType(entity.FieldTypeDouble)
+	case metaTypeBool:
+		f.WithDataType(entity.FieldTypeBool)
+	case metaTypeStringArray:
+		f.WithDataType(entity.FieldTypeArray).WithElementType(entity.FieldTypeVarChar).
+			WithMaxLength(field.MaxLength).WithMaxCapacity(field.MaxCapacity)
+	case metaTypeJSON:
+		f.WithDataType(entity.FieldTypeJSON)
+	}
+	if field.Nullable || field.Default != nil {
+		options, _ := json.Marshal(metaFieldOptions{Nullable: field.Nullable, Default: field.Default})
+		f.WithDescription(string(options))
+	}
+	return f
+}
+
+// metaFieldOf is the inverse of milvusMetaField.
+func metaFieldOf(f *entity.Field) (MetaField, bool) {
+	if f.IsDynamic {
+		return MetaField{}, false
+	}
+	var options metaFieldOptions
+	json.Unmarshal([]byte(f.Description), &options)
+	field := MetaField{Name: f.Name, Nullable: options.Nullable, Default: options.Default, PartitionKey: f.IsPartitionKey}
+	maxLength, _ := strconv.ParseInt(f.TypeParams[entity.TypeParamMaxLength], 10, 64)
+	switch {
+	case f.DataType == entity.FieldTypeVarChar:
+		field.Type, field.MaxLength = metaTypeString, maxLength
+	case f.DataType == entity.FieldTypeInt64:
+		field.Type = metaTypeInt
+	case f.DataType == entity.FieldTypeDouble:
+		field.Type = metaTypeFloat
+	case f.DataType == entity.FieldTypeBool:
+		field.Type = metaTypeBool
+	case f.DataType == entity.FieldTypeArray && f.ElementType == entity.FieldTypeVarChar:
+		maxCapacity, _ := strconv.ParseInt(f.TypeParams[entity.TypeParamMaxCapacity], 10, 64)
+		field.Type, field.MaxLength, field.MaxCapacity = metaTypeStringArray, maxLength, maxCapacity
+	case f.DataType == entity.FieldTypeJSON:
+		field.Type = metaTypeJSON
+	default:
+		return MetaField{}, false
+	}
+	return field, true
+}
+
+// metaColumn returns the insert column of field for rows. Milvus cannot store
+// nulls, so missing values of nullable fields are stored as zero values.
+func metaColumn(field MetaField, rows []VectorRow) entity.Column {
+	switch field.Type {
+	case metaTypeInt:
+		values := make([]int64, 0, len(rows))
+		for _, row := range rows {
+			values = append(values, field.storedValue(row.Meta[field.Name]).(int64))
+		}
+		return entity.NewColumnInt64(field.Name, values)
+	case metaTypeFloat:
+		values := make([]float64, 0, len(rows))
+		for _, row := range rows {
+			values = append(values, field.storedValue(row.Meta[field.Name]).(float64))
+		}
+		return entity.NewColumnDouble(field.Name, values)
+	case metaTypeBool:
+		values := make([]bool, 0, len(rows))
+		for _, row := range rows {
+			values = append(values, field.storedValue(row.Meta[field.Name]).(bool))
+		}
+		return entity.NewColumnBool(field.Name, values)
+	case metaTypeStringArray:
+		values := make([][][]byte, 0, len(rows))
+		for _, row := range rows {
+			var list [][]byte
+			for _, s := range field.storedValue(row.Meta[field.Name]).([]string) {
+				list = append(list, []byte(s))
+			}
+			values = append(values, list)
+		}
+		return entity.NewColumnVarCharArray(field.Name, values)
+	case metaTypeJSON:
+		values := make([][]byte, 0, len(rows))
+		for _, row := range rows {
+			data, _ := json.Marshal(field.storedValue(row.Meta[field.Name]))
+			values = append(values, data)
+		}
+		return entity.NewColumnJSONBytes(field.Name, values)
+	}
+	values := make([]string, 0, len(rows))
+	for _, row := range rows {
+		values = append(values, field.storedValue(row.Meta[field.Name]).(string))
+	}
+	return entity.NewColumnVarChar(field.Name, values)
+}
+
+// metaFromColumn reads the value of field at row i of a result column.
+func metaFromColumn(field MetaField, column entity.Column, i int) interface{} {
+	switch c := column.(type) {
+	case *entity.ColumnVarCharArray:
+		raw, _ := c.ValueByIdx(i)
+		list := make([]string, 0, len(raw))
+		for _, b := range raw {
+			list = append(list, string(b))
+		}
+		return list
+	case *entity.ColumnJSONBytes:
+		raw, _ := c.ValueByIdx(i)
+		var value map[string]interface{}
+		json.Unmarshal(raw, &value)
+		return field.storedValue(value)
+	}
+	switch field.Type {
+	case metaTypeInt:
+		value, _ := column.GetAsInt64(i)
+		return value
+	case metaTypeFloat:
+		value, _ := column.GetAsDouble(i)
+		return value
+	case metaTypeBool:
+		value, _ := column.GetAsBool(i)
+		return value
+	}
+	value, _ := column.GetAsString(i)
+	return value
+}
+
+func (s *milvusStore) Search(ctx context.Context, collection string, req SearchRequest) (SearchResult, error) {
+	it, err := lookupIndexType(req.IndexType)
+	if err != nil {
+		return SearchResult{}, err
+	}
+	sp, err := it.newSearchParam(req.TopK, req.Tuning)
+	if err != nil {
+		return SearchResult{}, err
+	}
+
+	schema, err := s.schema(ctx, collection)
+	if err != nil {
+		return SearchResult{}, err
+	}
+	if err := checkEmbeddingDim(req.Vector, schemaDim(schema)); err != nil {
+		return SearchResult{}, err
+	}
+	outputFields := []string{milvusUrlField}
+	hasHash, metaFields := schemaScalarFields(schema)
+	if hasHash {
+		outputFields = append(outputFields, milvusHashField)
+	}
+	for _, field := range metaFields {
+		outputFields = append(outputFields, field.Name)
+	}
+
+	vec2search := []entity.Vector{entity.FloatVector(req.Vector)}
+	sRet, err := s.c.Search(ctx, collection, req.Partitions, req.Filter, outputFields, vec2search,
+		milvusVecField, entity.MetricType(req.MetricType), req.TopK, sp)
+	if err != nil {
+		return SearchResult{}, milvusError(collection, err)
+	}
+
+	result := SearchResult{IndexType: req.IndexType, MetricType: req.MetricType, Params: sp.Params()}
+	for _, res := range sRet {
+		for i := 0; i < res.ResultCount; i++ {
+			id, _ := res.IDs.GetAsInt64(i)
+			url, _ := res.Fields.GetColumn(milvusUrlField).GetAsString(i)
+			hit := SearchHit{ID: id, Url: url, Score: res.Scores[i]}
+			hit.Metadata = rowMetadata(res.Fields, i, hasHash, metaFields)
+			result.Hits = append(result.Hits, hit)
+		}
+	}
+	return result, nil
+}
+
+// rowMetadata returns the hash and metadata fields of row i of rs, or nil
+// when the collection keeps neither.
+func rowMetadata(rs client.ResultSet, i int, hasHash bool, metaFields []MetaField) map[string]interface{} {
+	if !hasHash && len(metaFields) == 0 {
+		return nil
+	}
+	metadata := make(map[string]interface{}, len(metaFields)+1)
+	if hasHash {
+		metadata["hash"], _ = rs.GetColumn(milvusHashField).GetAsString(i)
+	}
+	for _, field := range metaFields {
+		if column := rs.GetColumn(field.Name); column != nil {
+			metadata[field.Name] = metaFromColumn(field, column, i)
+		}
+	}
+	return metadata
+}
+
+// QueryImages counts the matching rows, then queries the page. Milvus sorts
+// the results of a query with a limit by primary key.
+func (s *milvusStore) QueryImages(ctx context.Context, collection string, query ImageQuery) (ImagePage, error) {
+	hasHash, metaFields, err := s.scalarFields(ctx, collection)
+	if err != nil {
+		return ImagePage{}, err
+	}
+	var page ImagePage
+	rs, err := s.c.Query(ctx, collection, nil, query.Filter, []string{"count(*)"})
+	if err != nil {
+		return ImagePage{}, milvusError(collection, err)
+	}
+	if column := rs.GetColumn("count(*)"); column != nil {
+		page.Total, _ = column.GetAsInt64(0)
+	}
+	if int64(query.Offset) >= page.Total {
+		return page, nil
+	}
+
+	outputFields := []string{"id", milvusUrlField}
+	if hasHash {
+		outputFields = append(outputFields, milvusHashField)
+	}
+	for _, field := range metaFields {
+		outputFields = append(outputFields, field.Name)
+	}
+	rs, err = s.c.Query(ctx, collection, nil, query.Filter, outputFields,
+		client.WithOffset(int64(query.Offset)), client.WithLimit(int64(query.Limit)))
+	if err != nil {
+		return ImagePage{}, milvusError(collection, err)
+	}
+	ids, urls := rs.GetColumn("id"), rs.GetColumn(milvusUrlField)
+	if ids == nil || urls == nil {
+		return page, nil
+	}
+	for i := 0; i < ids.Len(); i++ {
+		image := StoredImage{Metadata: rowMetadata(rs, i, hasHash, metaFields)}
+		image.ID, _ = ids.GetAsInt64(i)
+		image.Url, _ = urls.GetAsString(i)
+		page.Images = append(page.Images, image)
+	}
+	sort.Slice(page.Images, func(i, j int) bool { return page.Images[i].ID < page.Images[j].ID })
+	return page, nil
+}
+
+func (s *milvusStore) Delete(ctx context.Context, collection string, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return milvusError(collection, s.c.DeleteByPks(ctx, collection, "", entity.NewColumnInt64("id", ids)))
+}
+
+func (s *milvusStore) DropCollection(ctx context.Context, collection string) error {
+	s.conn.forgetSchema(collection)
+	return milvusError(collection, s.c.DropCollection(ctx, collection))
+}
+
+func (s *milvusStore) Stats(ctx context.Context, collection string) (CollectionStats, error) {
+	stats := CollectionStats{Name: collection}
+	schema, err := s.schema(ctx, collection)
+	if err != nil {
+		return stats, err
+	}
+	stats.Dim = schemaDim(schema)
+	stats.HasHash, stats.MetaFields = schemaScalarFields(schema)
+	collStats, err := s.c.GetCollectionStatistics(ctx, collection)
+	if err != nil {
+		return stats, milvusError(collection, err)
+	}
+	stats.RowCount, _ = strconv.ParseInt(collStats["row_count"], 10, 64)
+	return stats, nil
+}
+
+func (s *milvusStore) Describe(ctx context.Context, collection string) (CollectionInfo, error) {
+	stats, err := s.Stats(ctx, collection)
+	info := CollectionInfo{CollectionStats: stats, IndexParams: map[string]interface{}{}, LoadState: loadStateNotLoaded}
+	if err != nil {
+		return info, err
+	}
+	coll, err := s.c.DescribeCollection(ctx, collection)
+	if err != nil {
+		return info, milvusError(collection, err)
+	}
+	info.Description = coll.Schema.Description
+
+	// A collection without an index makes DescribeIndex fail; it is reported
+	// with an empty index type.
+	if indexes, err := s.c.DescribeIndex(ctx, collection, milvusVecField); err == nil && len(indexes) > 0 {
+		params := indexes[0].Params()
+		info.IndexType = string(indexes[0].IndexType())
+		info.MetricType = params["metric_type"]
+		for key, value := range params {
+			switch key {
+			case "index_type", "metric_type":
+			case "params":
+				// The build parameters come as one JSON object.
+				var nested map[string]interface{}
+				if json.Unmarshal([]byte(value), &nested) == nil {
+					for k, v := range nested {
+						info.IndexParams[k] = v
+					}
+				}
+			default:
+				info.IndexParams[key] = value
+			}
+		}
+	}
+
+	state, err := s.c.GetLoadState(ctx, collection, nil)
+	if err != nil {
+		return info, milvusError(collection, err)
+	}
+	switch state {
+	case entity.LoadStateLoaded:
+		info.LoadState = loadStateLoaded
+	case entity.LoadStateLoading:
+		info.LoadState = loadStateLoading
+	}
+	return info, nil
+}
+
+func (s *milvusStore) ListCollections(ctx context.Context) ([]string, error) {
+	colls, err := s.c.ListCollections(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(colls))
+	for _, coll := range colls {
+		names = append(names, coll.Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *milvusStore) ListFiles(ctx context.Context, collection string, partition string) ([]IndexedFile, error) {
+	hasHash, _, err := s.scalarFields(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+	return s.queryFiles(ctx, collection, partition, "", hasHash)
+}
+
+// FindFiles queries the partitions one by one to learn the partition of each
+// row, which Milvus does not return. Collections with a partition key are
+// queried as a whole.
+func (s *milvusStore) FindFiles(ctx context.Context, collection string, filter string) ([]IndexedFile, error) {
+	hasHash, metaFields, err := s.scalarFields(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+	partitions := []string{""}
+	if _, ok := partitionKeyField(metaFields); !ok {
+		shown, err := s.c.ShowPartitions(ctx, collection)
+		if err != nil {
+			return nil, milvusError(collection, err)
+		}
+		partitions = partitions[:0]
+		for _, p := range shown {
+			partitions = append(partitions, p.Name)
+		}
+	}
+	var files []IndexedFile
+	for _, partition := range partitions {
+		found, err := s.queryFiles(ctx, collection, partition, filter, hasHash)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, found...)
+	}
+	return files, nil
+}
+
+// queryFiles returns the rows of partition, or of the whole collection when
+// partition is empty, that match expr.
+func (s *milvusStore) queryFiles(ctx context.Context, collection string, partition string, expr string, hasHash bool) ([]IndexedFile, error) {
+	outputFields := []string{milvusUrlField}
+	if hasHash {
+		outputFields = append(outputFields, milvusHashField)
+	}
+	opt := client.NewQueryIteratorOption(collection).WithOutputFields(outputFields...).WithBatchSize(1000)
+	if partition != "" {
+		opt.WithPartitions(partition)
+	}
+	if expr != "" {
+		opt.WithExpr(expr)
+	}
+	itr, err := s.c.QueryIterator(ctx, opt)
+	if err != nil {
+		return nil, milvusError(collection, err)
+	}
+	var files []IndexedFile
+	for {
+		rs, err := itr.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			return files, nil
+		}
+		if err != nil {
+			return nil, milvusError(collection, err)
+		}
+		ids, urls, hashes := rs.GetColumn("id"), rs.GetColumn(milvusUrlField), rs.GetColumn(milvusHashField)
+		for i := 0; i < ids.Len(); i++ {
+			file := IndexedFile{Partition: partition}
+			file.ID, _ = ids.GetAsInt64(i)
+			file.Url, _ = urls.GetAsString(i)
+			if hashes != nil {
+				file.Hash, _ = hashes.GetAsString(i)
+			}
+			files = append(files, file)
+		}
+	}
+}
+
+// CreatePartition adds partition to collection and loads it, so that it can be
+// searched as soon as rows are inserted. Collections with a partition key
+// field have their partitions managed by Milvus.
+func (s *milvusStore) CreatePartition(ctx context.Context, collection string, partition string) error {
+	_, metaFields, err := s.scalarFields(ctx, collection)
+	if err != nil {
+		return err
+	}
+	if field, ok := partitionKeyField(metaFields); ok {
+		return fmt.Errorf("%w: collection %s is partitioned by %s", errInvalidPartition, collection, field.Name)
+	}
+	if err := s.c.CreatePartition(ctx, collection, partition); err != nil {
+		return milvusError(collection, err)
+	}
+	return milvusError(collection, s.c.LoadPartitions(ctx, collection, []string{partition}, false))
+}
+
+func (s *milvusStore) ListPartitions(ctx context.Context, collection string) ([]PartitionInfo, error) {
+	partitions, err := s.c.ShowPartitions(ctx, collection)
+	if err != nil {
+		return nil, milvusError(collection, err)
+	}
+	infos := make([]PartitionInfo, 0, len(partitions))
+	for _, p := range partitions {
+		info := PartitionInfo{Name: p.Name}
+		// The SDK has no partition statistics call, so count the rows. It
+		// needs the partition to be loaded; unloaded ones report 0.
+		rs, err := s.c.Query(ctx, collection, []string{p.Name}, "", []string{"count(*)"})
+		if err == nil && rs.GetColumn("count(*)") != nil {
+			info.RowCount, _ = rs.GetColumn("count(*)").GetAsInt64(0)
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// DropPartition releases partition before dropping it, since Milvus refuses
+// to drop a loaded partition.
+func (s *milvusStore) DropPartition(ctx context.Context, collection string, partition string) error {
+	if partition == defaultPartition {
+		return fmt.Errorf("%w: the %s partition cannot be dropped", errInvalidPartition, defaultPartition)
+	}
+	ok, err := s.c.HasPartition(ctx, collection, partition)
+	if err != nil {
+		return milvusError(collection, err)
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s.%s", errPartitionNotFound, collection, partition)
+	}
+	if err := s.c.ReleasePartitions(ctx, collection, []string{partition}); err != nil {
+		return milvusError(collection, err)
+	}
+	return milvusError(collection, s.c.DropPartition(ctx, collection, partition))
+}
+
+// milvusError wraps the Milvus errors about a missing or an existing
+// collection or partition with errCollectionNotFound, errCollectionExists,
+// errPartitionNotFound and errPartitionExists.
+func milvusError(collection string, err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "partition") && (strings.Contains(msg, "not found") || strings.Contains(msg, "not exist")):
+		return fmt.Errorf("%w: %s: %s", errPartitionNotFound, collection, err.Error())
+	case strings.Contains(msg, "partition") && strings.Contains(msg, "already exist"):
+		return fmt.Errorf("%w: %s: %s", errPartitionExists, collection, err.Error())
+	case strings.Contains(msg, "partition"):
+		return err
+	case strings.Contains(msg, "collection not found"), strings.Contains(msg, "can't find collection"),
+		strings.Contains(msg, "collection "+strings.ToLower(collection)+" does not exist"):
+		return fmt.Errorf("%w: %s: %s", errCollectionNotFound, collection, err.Error())
+	case strings.Contains(msg, "already exist"):
+		return fmt.Errorf("%w: %s: %s", errCollectionExists, collection, err.Error())
+	case strings.Contains(msg, "cannot parse expression"):
+		return fmt.Errorf("%w: %s", errInvalidFilter, err.Error())
+	}
+	return err
+}
+
+// Close returns the client to the pool, which keeps the connection open for
+// the next request.
+func (s *milvusStore) Close() error {
+	if s.conn != nil {
+		milvusClients.release(s.conn)
+		s.conn = nil
+	}
+	return nil
+}
@@ -4,3 +4,5 @@ export const PicImportUrl = '/api/onPicImport'
 export const picSearchByTextUrl = '/api/picSearchByText'
 export const picSearchByImgUrl = '/api/picSearchByImg'
 export const UploadUrl = '/api/uploadImageFiles'
+export const jobsUrl = '/api/jobs'
+export const instancesUrl = '/api/instances'
@@ -13,7 +13,27 @@ export const useMilvusInstanceStore = defineStore('milvusInstance', () => {
     ModelUrl: 'http://localhost:8010',
     Model_API_KEY: '',
     ModelVecDim: '1024',
+    // 服务端实例注册表中的名称, 设置后请求只需携带实例名称
+    InstanceName: '',
   })
 
-  return { milvusInstance }
+  // 请求中标识实例的参数, 已注册时不再携带 milvus 和模型服务的账号密钥
+  const instanceParams = () => {
+    if (milvusInstance.InstanceName !== '') {
+      return { instance: milvusInstance.InstanceName }
+    }
+    return {
+      milvus_server: milvusInstance.MilvusServerName,
+      milvus_port: milvusInstance.MilvusServerPort,
+      milvus_username: milvusInstance.MilvusServerUserName,
+      milvus_pass: milvusInstance.MilvusServerPassWord,
+      collection_name: milvusInstance.MilvusCollectionName,
+      index_name: milvusInstance.MilvusIndexName,
+      metric_type: milvusInstance.MilvusMetricType,
+      embed_server_url: milvusInstance.ModelUrl,
+      embed_server_apikey: milvusInstance.Model_API_KEY,
+    }
+  }
+
+  return { milvusInstance, instanceParams }
 })